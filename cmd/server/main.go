@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/handlers"
 	"github.com/vlah-software-house/paddle-api-mock/internal/middleware"
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+	"github.com/vlah-software-house/paddle-api-mock/internal/payout"
 	"github.com/vlah-software-house/paddle-api-mock/internal/seed"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
 	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
@@ -22,8 +29,39 @@ func main() {
 	webhookURL := flag.String("webhook-url", "", "Default webhook URL to register on startup")
 	signingSecret := flag.String("signing-secret", "pdl_test_signing_secret", "Webhook signing secret")
 	apiKey := flag.String("api-key", "test_paddle_api_key", "API key for authentication")
+	baseURL := flag.String("base-url", "", "Public URL of the mock, used in checkout and invoice links (default http://localhost:<port>)")
+	strict := flag.Bool("strict", false, "Paddle-faithful mode: disable POST /v1/subscriptions; subscriptions are created by completed transactions")
+	payoutCurrency := flag.String("payout-currency", "USD", "Balance currency for payout totals")
+	feePercent := flag.String("fee-percent", "5", "Paddle fee percentage of each transaction's grand total")
+	feeFixed := flag.Int("fee-fixed", 50, "Fixed Paddle fee per transaction, in the lowest unit of the payout currency")
+	exchangeRates := flag.String("exchange-rates", "", "JSON file of exchange rates (value of one unit in USD), merged over the built-in table")
+	webhookRetries := flag.Int("webhook-retries", 3, "Times a failed webhook delivery is retried")
+	webhookRetryInterval := flag.Duration("webhook-retry-interval", 2*time.Minute, "Delay before the first webhook retry; each retry after that waits twice as long")
 	flag.Parse()
 
+	if *baseURL == "" {
+		*baseURL = fmt.Sprintf("http://localhost:%d", *port)
+	}
+
+	payoutConfig := payout.Default()
+	payoutConfig.Currency = strings.ToUpper(*payoutCurrency)
+	fee, err := money.ParseRate(*feePercent)
+	if err != nil || fee.Sign() < 0 {
+		log.Fatalf("Invalid -fee-percent %q: must be a non-negative decimal", *feePercent)
+	}
+	payoutConfig.FeePercent = fee
+	payoutConfig.FeeFixed = money.Amount(*feeFixed)
+	if *exchangeRates != "" {
+		if err := payoutConfig.LoadRates(*exchangeRates); err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+		log.Printf("Loaded exchange rates from %s", *exchangeRates)
+	}
+	if err := payoutConfig.Validate(); err != nil {
+		log.Fatalf("Invalid payout configuration: %v", err)
+	}
+	handlers.SetPayoutConfig(payoutConfig)
+
 	s := store.New()
 	if !*noSeed {
 		seed.Load(s)
@@ -31,28 +69,22 @@ func main() {
 	}
 
 	notifier := webhook.New(s, *signingSecret)
+	notifier.MaxRetries = *webhookRetries
+	notifier.RetryInterval = *webhookRetryInterval
 
 	// Register default webhook URL if provided
 	if *webhookURL != "" {
 		now := time.Now().UTC()
 		s.SetNotificationSetting(&models.NotificationSetting{
-			ID:          store.NextID("ntfset"),
-			Description: "Default webhook (from CLI)",
-			Destination: *webhookURL,
-			Active:      true,
-			APIVersion:  1,
-			SubscribedEvents: []string{
-				"subscription.created",
-				"subscription.updated",
-				"subscription.activated",
-				"subscription.canceled",
-				"subscription.past_due",
-				"transaction.completed",
-				"transaction.payment_failed",
-			},
-			Type:      "url",
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:               store.NextID("ntfset"),
+			Description:      "Default webhook (from CLI)",
+			Destination:      *webhookURL,
+			Active:           true,
+			APIVersion:       1,
+			SubscribedEvents: webhook.EventTypeNames(),
+			Type:             "url",
+			CreatedAt:        now,
+			UpdatedAt:        now,
 		})
 		log.Printf("Registered default webhook URL: %s", *webhookURL)
 	}
@@ -60,11 +92,19 @@ func main() {
 	// Set up handlers
 	productsH := &handlers.ProductsHandler{Store: s}
 	pricesH := &handlers.PricesHandler{Store: s}
-	customersH := &handlers.CustomersHandler{Store: s}
-	subscriptionsH := &handlers.SubscriptionsHandler{Store: s, Webhook: notifier}
-	transactionsH := &handlers.TransactionsHandler{Store: s}
+	customersH := &handlers.CustomersHandler{Store: s, Webhook: notifier}
+	subscriptionsH := &handlers.SubscriptionsHandler{Store: s, Webhook: notifier, Strict: *strict}
+	transactionsH := &handlers.TransactionsHandler{Store: s, Webhook: notifier, BaseURL: *baseURL}
+	adjustmentsH := &handlers.AdjustmentsHandler{Store: s, Webhook: notifier}
+	discountsH := &handlers.DiscountsHandler{Store: s, Webhook: notifier}
+	reportsH := &handlers.ReportsHandler{Store: s, Webhook: notifier, BaseURL: *baseURL}
+	simulationsH := &handlers.SimulationsHandler{Store: s, Webhook: notifier}
 	eventsH := &handlers.EventsHandler{Store: s}
+	eventTypesH := &handlers.EventTypesHandler{}
 	notifSettingsH := &handlers.NotificationSettingsHandler{Store: s}
+	notificationsH := &handlers.NotificationsHandler{Store: s, Webhook: notifier}
+	invoicesH := &handlers.InvoicesHandler{Store: s}
+	checkoutH := &handlers.CheckoutHandler{Store: s, Webhook: notifier, BaseURL: *baseURL}
 	adminH := &handlers.AdminHandler{Store: s, Webhook: notifier, SeedEnabled: !*noSeed, DefaultWebhookURL: *webhookURL}
 
 	mux := http.NewServeMux()
@@ -80,9 +120,29 @@ func main() {
 	mux.Handle("/v1/subscriptions/", subscriptionsH)
 	mux.Handle("/v1/transactions", transactionsH)
 	mux.Handle("/v1/transactions/", transactionsH)
+	mux.Handle("/v1/adjustments", adjustmentsH)
+	mux.Handle("/v1/adjustments/", adjustmentsH)
+	mux.Handle("/v1/discounts", discountsH)
+	mux.Handle("/v1/discounts/", discountsH)
+	mux.Handle("/v1/reports", reportsH)
+	mux.Handle("/v1/reports/", reportsH)
+	mux.Handle("/v1/simulations", simulationsH)
+	mux.Handle("/v1/simulations/", simulationsH)
 	mux.Handle("/v1/events", eventsH)
+	mux.Handle("/v1/event-types", eventTypesH)
 	mux.Handle("/v1/notification-settings", notifSettingsH)
 	mux.Handle("/v1/notification-settings/", notifSettingsH)
+	mux.Handle("/v1/notifications", notificationsH)
+	mux.Handle("/v1/notifications/", notificationsH)
+
+	// Generated documents (unauthenticated, like Paddle's pre-signed links)
+	mux.Handle("/invoices/", invoicesH)
+	mux.Handle("/reports/", &handlers.ReportFilesHandler{Store: s})
+
+	// Hosted checkout (the page behind checkout.url) and paddle.js
+	mux.Handle("/checkout", checkoutH)
+	mux.Handle("/checkout/", checkoutH)
+	mux.Handle("/paddle.js", &handlers.PaddleJSHandler{})
 
 	// Admin routes
 	mux.Handle("/admin/", adminH)
@@ -100,8 +160,27 @@ func main() {
 	handler = middleware.RequestID(handler)
 
 	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("Paddle Mock API starting on %s (auth=%v, seed=%v)", addr, !*noAuth, !*noSeed)
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		log.Printf("Paddle Mock API starting on %s (auth=%v, seed=%v, strict=%v)", addr, !*noAuth, !*noSeed, *strict)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// On shutdown, finish in-flight requests, then send the webhooks they
+	// queued before exiting.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	if err := notifier.Drain(ctx); err != nil {
+		log.Printf("Webhook queue not drained: %v", err)
 	}
 }
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+type AdjustmentsHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+}
+
+func (h *AdjustmentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/adjustments")
+	path = strings.TrimPrefix(path, "/")
+	if path != "" {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (h *AdjustmentsHandler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	adjustments := make([]*models.Adjustment, 0)
+	for _, adj := range h.Store.ListAdjustments(q.Get("transaction_id")) {
+		if id := q.Get("id"); id != "" && adj.ID != id {
+			continue
+		}
+		if subID := q.Get("subscription_id"); subID != "" && (adj.SubscriptionID == nil || *adj.SubscriptionID != subID) {
+			continue
+		}
+		if cid := q.Get("customer_id"); cid != "" && adj.CustomerID != cid {
+			continue
+		}
+		if action := q.Get("action"); action != "" && adj.Action != action {
+			continue
+		}
+		if status := q.Get("status"); status != "" && adj.Status != status {
+			continue
+		}
+		adjustments = append(adjustments, adj)
+	}
+	respondList(w, r, adjustments, len(adjustments))
+}
+
+func (h *AdjustmentsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAdjustmentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.Action != "refund" && req.Action != "credit" && req.Action != "chargeback" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "action must be refund, credit or chargeback")
+		return
+	}
+	if req.TransactionID == "" || req.Reason == "" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "transaction_id and reason are required")
+		return
+	}
+	txn, ok := h.Store.GetTransaction(req.TransactionID)
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Transaction not found: "+req.TransactionID)
+		return
+	}
+
+	adj, apiErr := newAdjustment(h.Store, txn, req, time.Now().UTC())
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	if apiErr := recordAdjustment(h.Store, h.Webhook, txn, adj); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	respond(w, r, http.StatusCreated, adj)
+}
+
+// adjustmentStatuses are the transaction statuses each adjustment action
+// can be made against. Only collected money can be refunded or charged back;
+// credits can also reduce what is owed on an unpaid invoice.
+var adjustmentStatuses = map[string][]string{
+	"refund":     {"completed"},
+	"chargeback": {"completed"},
+	"credit":     {"billed", "past_due", "completed"},
+}
+
+// newAdjustment validates req against txn and builds (but does not store) the
+// adjustment. Refunds wait for approval; credits and chargebacks are
+// approved straight away.
+func newAdjustment(s *store.Store, txn *models.Transaction, req models.CreateAdjustmentRequest, now time.Time) (*models.Adjustment, *apiError) {
+	allowed := false
+	for _, status := range adjustmentStatuses[req.Action] {
+		if txn.Status == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, &apiError{
+			Status: http.StatusBadRequest,
+			Type:   "request_error",
+			Code:   "adjustment_transaction_invalid_status_for_" + req.Action,
+			Detail: "Cannot " + req.Action + " a transaction that is " + txn.Status,
+		}
+	}
+
+	existing := s.ListAdjustments(txn.ID)
+	if req.Action == "refund" {
+		if apiErr := pendingRefundError(existing); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+
+	adjType := req.Type
+	if adjType == "" {
+		adjType = "partial"
+	}
+	if adjType != "full" && adjType != "partial" {
+		return nil, validationError("type must be full or partial")
+	}
+
+	items, apiErr := adjustmentItems(txn, existing, adjType, req.Items)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var subtotal, tax money.Amount
+	for _, item := range items {
+		subtotal += storedAmount(item.Totals.Subtotal)
+		tax += storedAmount(item.Totals.Tax)
+	}
+
+	adj := &models.Adjustment{
+		ID:             store.NextID("adj"),
+		Action:         req.Action,
+		Type:           adjType,
+		TransactionID:  txn.ID,
+		SubscriptionID: txn.SubscriptionID,
+		CustomerID:     txn.CustomerID,
+		Reason:         req.Reason,
+		CurrencyCode:   txn.CurrencyCode,
+		Status:         "approved",
+		Items:          items,
+		Totals: models.AdjustmentTotals{
+			Subtotal:     subtotal.String(),
+			Tax:          tax.String(),
+			Total:        (subtotal + tax).String(),
+			CurrencyCode: txn.CurrencyCode,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	switch req.Action {
+	case "refund":
+		adj.Status = "pending_approval"
+	case "credit":
+		// Credit on a paid transaction goes to the customer's balance; on an
+		// unpaid one it reduces the amount due.
+		toBalance := txn.Status == "completed"
+		adj.CreditAppliedToBalance = &toBalance
+	}
+	return adj, nil
+}
+
+// adjustmentItems builds the adjustment items for the requested line items,
+// or for every line item with a full adjustment. Amounts may not exceed what
+// is left of each line item or of the transaction after earlier adjustments.
+func adjustmentItems(txn *models.Transaction, existing []*models.Adjustment, adjType string, reqs []models.CreateAdjustmentItemReq) ([]models.AdjustmentItem, *apiError) {
+	remaining := remainingAdjustable(txn, existing)
+
+	if adjType == "full" {
+		if len(reqs) > 0 {
+			return nil, validationError("items must be omitted for full adjustments")
+		}
+		for _, line := range txn.Details.LineItems {
+			if remaining[line.ID] > 0 {
+				reqs = append(reqs, models.CreateAdjustmentItemReq{ItemID: line.ID, Type: "full"})
+			}
+		}
+		if len(reqs) == 0 {
+			return nil, adjustmentAmountError("adjustment_amount_above_remaining_allowed", "Transaction has already been fully adjusted")
+		}
+	} else if len(reqs) == 0 {
+		return nil, validationError("items are required for partial adjustments")
+	}
+
+	items := make([]models.AdjustmentItem, 0, len(reqs))
+	var total money.Amount
+	for _, req := range reqs {
+		var line *models.TransactionLineItem
+		for i := range txn.Details.LineItems {
+			if txn.Details.LineItems[i].ID == req.ItemID {
+				line = &txn.Details.LineItems[i]
+			}
+		}
+		if line == nil {
+			return nil, &apiError{
+				Status: http.StatusBadRequest,
+				Type:   "request_error",
+				Code:   "adjustment_transaction_item_invalid",
+				Detail: "Item not found on transaction " + txn.ID + ": " + req.ItemID,
+			}
+		}
+
+		var amount money.Amount
+		switch req.Type {
+		case "full":
+			amount = remaining[line.ID]
+		case "partial":
+			var err error
+			if amount, err = money.Parse(req.Amount); err != nil {
+				return nil, validationError("Invalid amount for " + line.ID + ": " + err.Error())
+			}
+		default:
+			return nil, validationError("item type must be full or partial")
+		}
+		if amount <= 0 {
+			return nil, adjustmentAmountError("adjustment_amount_cannot_be_zero", "Adjustment amount for "+line.ID+" must be greater than zero")
+		}
+		if amount > remaining[line.ID] {
+			return nil, adjustmentAmountError("adjustment_amount_above_remaining_allowed",
+				"Adjustment amount for "+line.ID+" is above the remaining "+remaining[line.ID].String())
+		}
+		remaining[line.ID] -= amount
+		total += amount
+
+		// Tax is adjusted in proportion to the line item's own tax.
+		var tax money.Amount
+		if lineTotal := storedAmount(line.Totals.Total); lineTotal > 0 {
+			share := big.NewRat(int64(storedAmount(line.Totals.Tax)), int64(lineTotal))
+			tax = amount.Scale(share, money.HalfUp)
+		}
+		items = append(items, models.AdjustmentItem{
+			ID:        store.NextID("adjitm"),
+			ItemID:    line.ID,
+			Type:      req.Type,
+			Amount:    amount.String(),
+			Proration: line.Proration,
+			Totals: models.AdjustmentItemTotals{
+				Subtotal: (amount - tax).String(),
+				Tax:      tax.String(),
+				Total:    amount.String(),
+			},
+		})
+	}
+
+	if total > remaining[""] {
+		return nil, adjustmentAmountError("adjustment_total_amount_above_remaining_allowed",
+			"Adjustment total is above the remaining "+remaining[""].String()+" on transaction "+txn.ID)
+	}
+	return items, nil
+}
+
+// pendingRefundError rejects a refund while one of the existing adjustments
+// is a refund awaiting approval.
+func pendingRefundError(existing []*models.Adjustment) *apiError {
+	for _, adj := range existing {
+		if adj.Action == "refund" && adj.Status == "pending_approval" {
+			return &apiError{
+				Status: http.StatusBadRequest,
+				Type:   "request_error",
+				Code:   "adjustment_pending_refund_request",
+				Detail: "Transaction already has a refund awaiting approval: " + adj.ID,
+			}
+		}
+	}
+	return nil
+}
+
+// checkAdjustable checks adj, built by newAdjustment, against the existing
+// adjustments of its transaction again, as others may have been made since.
+// Reversals give money back, so are always allowed.
+func checkAdjustable(txn *models.Transaction, adj *models.Adjustment, existing []*models.Adjustment) *apiError {
+	if adjustmentSign(adj.Action) < 0 {
+		return nil
+	}
+	if adj.Action == "refund" {
+		if apiErr := pendingRefundError(existing); apiErr != nil {
+			return apiErr
+		}
+	}
+	remaining := remainingAdjustable(txn, existing)
+	for _, item := range adj.Items {
+		amount := storedAmount(item.Totals.Total)
+		if amount > remaining[item.ItemID] {
+			return adjustmentAmountError("adjustment_amount_above_remaining_allowed",
+				"Adjustment amount for "+item.ItemID+" is above the remaining "+remaining[item.ItemID].String())
+		}
+		remaining[item.ItemID] -= amount
+	}
+	if total := storedAmount(adj.Totals.Total); total > remaining[""] {
+		return adjustmentAmountError("adjustment_total_amount_above_remaining_allowed",
+			"Adjustment total is above the remaining "+remaining[""].String()+" on transaction "+txn.ID)
+	}
+	return nil
+}
+
+func adjustmentAmountError(code, detail string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Type: "request_error", Code: code, Detail: detail}
+}
+
+// remainingAdjustable returns how much of each line item of txn, keyed by
+// line item ID, can still be adjusted, and under "" how much of the grand
+// total can, after the existing adjustments against it. Pending adjustments
+// count against the remaining amount.
+func remainingAdjustable(txn *models.Transaction, existing []*models.Adjustment) map[string]money.Amount {
+	remaining := map[string]money.Amount{"": storedAmount(txn.Details.Totals.GrandTotal)}
+	for _, line := range txn.Details.LineItems {
+		remaining[line.ID] = storedAmount(line.Totals.Total)
+	}
+	for _, adj := range existing {
+		if adj.Status == "rejected" {
+			continue
+		}
+		sign := adjustmentSign(adj.Action)
+		for _, item := range adj.Items {
+			remaining[item.ItemID] -= sign * storedAmount(item.Totals.Total)
+		}
+		remaining[""] -= sign * storedAmount(adj.Totals.Total)
+	}
+	return remaining
+}
+
+// adjustmentSign is 1 for actions that take money back from the transaction
+// and -1 for those that reverse an earlier adjustment.
+func adjustmentSign(action string) money.Amount {
+	if strings.HasSuffix(action, "_reverse") {
+		return -1
+	}
+	return 1
+}
+
+// updateAdjustedTotals recomputes txn's adjusted_totals from its approved
+// adjustments.
+func updateAdjustedTotals(s *store.Store, txn *models.Transaction) {
+	totals := txn.Details.Totals
+	subtotal := storedAmount(totals.Subtotal) - storedAmount(totals.Discount)
+	tax := storedAmount(totals.Tax)
+	total := storedAmount(totals.Total)
+	grandTotal := storedAmount(totals.GrandTotal)
+	for _, adj := range s.ListAdjustments(txn.ID) {
+		// A reversed chargeback still counts; its chargeback_reverse
+		// adjustment adds the money back.
+		if adj.Status != "approved" && adj.Status != "reversed" {
+			continue
+		}
+		sign := adjustmentSign(adj.Action)
+		subtotal -= sign * storedAmount(adj.Totals.Subtotal)
+		tax -= sign * storedAmount(adj.Totals.Tax)
+		total -= sign * storedAmount(adj.Totals.Total)
+		grandTotal -= sign * storedAmount(adj.Totals.Total)
+	}
+	txn.Details.AdjustedTotals = models.AdjustedTotals{
+		Subtotal:     subtotal.String(),
+		Tax:          tax.String(),
+		Total:        total.String(),
+		GrandTotal:   grandTotal.String(),
+		CurrencyCode: totals.CurrencyCode,
+	}
+}
+
+// recordAdjustment stores a new adjustment, updates the transaction's
+// adjusted totals if it is already approved and fires adjustment.created. It
+// fails if adjustments made since adj was built leave too little to adjust.
+func recordAdjustment(s *store.Store, n *webhook.Notifier, txn *models.Transaction, adj *models.Adjustment) *apiError {
+	err := s.AddAdjustment(adj, func(existing []*models.Adjustment) error {
+		if apiErr := checkAdjustable(txn, adj, existing); apiErr != nil {
+			return apiErr
+		}
+		return nil
+	})
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	if adj.Status == "approved" {
+		updateAdjustedTotals(s, txn)
+		txn.UpdatedAt = adj.UpdatedAt
+		s.SetTransaction(txn)
+	}
+	n.Fire("adjustment.created", adj)
+	return nil
+}
+
+// decideAdjustment approves or rejects an adjustment awaiting approval, as
+// Paddle's team does for refunds, and fires adjustment.updated.
+func decideAdjustment(s *store.Store, n *webhook.Notifier, adj *models.Adjustment, status string, now time.Time) *apiError {
+	if adj.Status != "pending_approval" {
+		return &apiError{
+			Status: http.StatusBadRequest,
+			Type:   "request_error",
+			Code:   "adjustment_invalid_status_change",
+			Detail: "Only adjustments pending approval can be " + status + ", adjustment is " + adj.Status,
+		}
+	}
+	adj.Status = status
+	adj.UpdatedAt = now
+	s.SetAdjustment(adj)
+
+	if status == "approved" {
+		if txn, ok := s.GetTransaction(adj.TransactionID); ok {
+			updateAdjustedTotals(s, txn)
+			txn.UpdatedAt = now
+			s.SetTransaction(txn)
+		}
+	}
+	n.Fire("adjustment.updated", adj)
+	return nil
+}
@@ -27,6 +27,25 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(path, "advance-time/") && r.Method == http.MethodPost:
 		subID := strings.TrimPrefix(path, "advance-time/")
 		h.advanceTime(w, r, subID)
+	case path == "checkout" && r.Method == http.MethodPost:
+		h.checkout(w, r)
+	case strings.HasPrefix(path, "pay-transaction/") && r.Method == http.MethodPost:
+		txnID := strings.TrimPrefix(path, "pay-transaction/")
+		h.payTransaction(w, r, txnID)
+	case strings.HasPrefix(path, "adjustments/") && r.Method == http.MethodPost:
+		h.decideAdjustment(w, r, strings.TrimPrefix(path, "adjustments/"))
+	case strings.HasPrefix(path, "chargebacks/") && strings.HasSuffix(path, "/reverse") && r.Method == http.MethodPost:
+		adjID := strings.TrimSuffix(strings.TrimPrefix(path, "chargebacks/"), "/reverse")
+		h.reverseChargeback(w, r, adjID)
+	case strings.HasPrefix(path, "chargebacks/") && r.Method == http.MethodPost:
+		h.openChargeback(w, r, strings.TrimPrefix(path, "chargebacks/"))
+	case path == "payment-rules" && r.Method == http.MethodGet:
+		rules := h.Store.ListPaymentRules()
+		respondList(w, r, rules, len(rules))
+	case path == "payment-rules" && r.Method == http.MethodPost:
+		h.createPaymentRule(w, r)
+	case strings.HasPrefix(path, "payment-rules/") && r.Method == http.MethodDelete:
+		h.deletePaymentRule(w, r, strings.TrimPrefix(path, "payment-rules/"))
 	case strings.HasPrefix(path, "trigger-webhook/") && r.Method == http.MethodPost:
 		eventType := strings.TrimPrefix(path, "trigger-webhook/")
 		h.triggerWebhook(w, r, eventType)
@@ -44,23 +63,15 @@ func (h *AdminHandler) reset(w http.ResponseWriter, r *http.Request) {
 	if h.DefaultWebhookURL != "" {
 		now := time.Now().UTC()
 		h.Store.SetNotificationSetting(&models.NotificationSetting{
-			ID:          store.NextID("ntfset"),
-			Description: "Default webhook (from CLI)",
-			Destination: h.DefaultWebhookURL,
-			Active:      true,
-			APIVersion:  1,
-			SubscribedEvents: []string{
-				"subscription.created",
-				"subscription.updated",
-				"subscription.activated",
-				"subscription.canceled",
-				"subscription.past_due",
-				"transaction.completed",
-				"transaction.payment_failed",
-			},
-			Type:      "url",
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:               store.NextID("ntfset"),
+			Description:      "Default webhook (from CLI)",
+			Destination:      h.DefaultWebhookURL,
+			Active:           true,
+			APIVersion:       1,
+			SubscribedEvents: webhook.EventTypeNames(),
+			Type:             "url",
+			CreatedAt:        now,
+			UpdatedAt:        now,
 		})
 	}
 	respond(w, r, http.StatusOK, map[string]string{"status": "reset"})
@@ -72,189 +83,454 @@ func (h *AdminHandler) advanceTime(w http.ResponseWriter, r *http.Request, subID
 		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Subscription not found")
 		return
 	}
+	if apiErr := checkSubscriptionAction(sub, actionAdvance); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
 
 	now := time.Now().UTC()
 
+	// A scheduled cancel or pause takes effect at the end of the current
+	// period instead of the next renewal.
+	if sub.ScheduledChange != nil && sub.ScheduledChange.Action != "resume" {
+		action := sub.ScheduledChange.Action
+		status, eventType := "canceled", "subscription.canceled"
+		if action == "pause" {
+			status, eventType = "paused", "subscription.paused"
+		}
+		if apiErr := transitionSubscription(sub, status, now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+		sub.ScheduledChange = nil
+		if status == "paused" {
+			sub.CurrentBillingPeriod = nil
+		}
+		h.Store.SetSubscription(sub)
+		h.Webhook.Fire(eventType, sub)
+		respond(w, r, http.StatusOK, sub)
+		return
+	}
+
 	switch sub.Status {
 	case "trialing":
-		// Trial → active: simulate trial ending
-		sub.Status = "active"
-		sub.FirstBilledAt = &now
-		sub.UpdatedAt = now
-
-		nextBill := addPeriod(now, sub.BillingCycle.Interval, sub.BillingCycle.Frequency)
-		sub.NextBilledAt = &nextBill
-		sub.CurrentBillingPeriod = &models.BillingPeriodDates{
-			StartsAt: now,
-			EndsAt:   nextBill,
+		// Trial → active: simulate trial ending. The first charge is made
+		// without the customer present, so it fails if a payment rule requires
+		// 3-D Secure and the subscription goes past_due instead.
+		if requires3DS(h.Store, sub.CustomerID) {
+			if apiErr := transitionSubscription(sub, "past_due", now); apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
+			h.Store.SetSubscription(sub)
+			txn := h.createFailedTransaction(sub, "authentication_required")
+			h.Webhook.Fire("subscription.past_due", sub)
+			h.Webhook.Fire("transaction.payment_failed", txn)
+			h.Webhook.Fire("transaction.past_due", txn)
+			break
 		}
-
+		if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+		sub.FirstBilledAt = &now
+		startBillingPeriod(sub, now)
+		startSubscriptionDiscount(h.Store, sub)
 		for i := range sub.Items {
-			sub.Items[i].Status = "active"
 			sub.Items[i].TrialDates = nil
 			sub.Items[i].PreviouslyBilledAt = &now
-			sub.Items[i].NextBilledAt = &nextBill
-			sub.Items[i].UpdatedAt = now
 		}
 
 		h.Store.SetSubscription(sub)
-		h.createTransaction(sub, "subscription_recurring")
+		txn := h.createTransaction(sub, "subscription_recurring")
 		h.Webhook.Fire("subscription.activated", sub)
-		h.Webhook.Fire("transaction.completed", h.Store.ListTransactions()[len(h.Store.ListTransactions())-1])
+		h.Webhook.Fire("transaction.completed", txn)
 
 	case "active":
 		// Active → simulate billing cycle. 50/50 chance of payment failure for testing,
-		// but default to success. Use query param ?fail=true to force failure.
+		// but default to success. Use query param ?fail=true to force failure, with
+		// an optional &error_code= decline reason. Renewals are charged without
+		// the customer present, so they also fail when a payment rule requires
+		// 3-D Secure.
+		errorCode := ""
 		if r.URL.Query().Get("fail") == "true" {
-			sub.Status = "past_due"
-			sub.UpdatedAt = now
+			var apiErr *apiError
+			errorCode, apiErr = paymentErrorCode(r.URL.Query().Get("error_code"))
+			if apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
+		} else if requires3DS(h.Store, sub.CustomerID) {
+			errorCode = "authentication_required"
+		}
+		if errorCode != "" {
+			if apiErr := transitionSubscription(sub, "past_due", now); apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
 			h.Store.SetSubscription(sub)
 
 			// Create failed transaction
-			txn := h.createFailedTransaction(sub)
+			txn := h.createFailedTransaction(sub, errorCode)
 			h.Webhook.Fire("subscription.past_due", sub)
 			h.Webhook.Fire("transaction.payment_failed", txn)
+			h.Webhook.Fire("transaction.past_due", txn)
 		} else {
 			// Successful billing — advance to next period
 			prevEnd := now
 			if sub.CurrentBillingPeriod != nil {
 				prevEnd = sub.CurrentBillingPeriod.EndsAt
 			}
-			nextBill := addPeriod(prevEnd, sub.BillingCycle.Interval, sub.BillingCycle.Frequency)
-			sub.NextBilledAt = &nextBill
-			sub.CurrentBillingPeriod = &models.BillingPeriodDates{
-				StartsAt: prevEnd,
-				EndsAt:   nextBill,
+			if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
 			}
-			sub.UpdatedAt = now
-
+			startBillingPeriod(sub, prevEnd)
 			for i := range sub.Items {
 				sub.Items[i].PreviouslyBilledAt = &prevEnd
-				sub.Items[i].NextBilledAt = &nextBill
-				sub.Items[i].UpdatedAt = now
 			}
 
 			h.Store.SetSubscription(sub)
-			h.createTransaction(sub, "subscription_recurring")
+			txn := h.createTransaction(sub, "subscription_recurring")
 			h.Webhook.Fire("subscription.updated", sub)
-			h.Webhook.Fire("transaction.completed", h.Store.ListTransactions()[len(h.Store.ListTransactions())-1])
+			h.Webhook.Fire("transaction.completed", txn)
 		}
 
 	case "past_due":
-		// past_due → canceled
-		sub.Status = "canceled"
-		sub.CanceledAt = &now
-		sub.UpdatedAt = now
-		sub.ScheduledChange = nil
+		// Payment retry for the past_due transaction. With ?recover=true the retry
+		// succeeds and the subscription renews; otherwise the final retry fails
+		// (reason from ?error_code=) and the subscription is canceled.
+		txn := h.pastDueTransaction(sub)
+		if r.URL.Query().Get("recover") == "true" {
+			if txn != nil {
+				card := defaultCard(now)
+				if len(txn.Payments) > 0 && txn.Payments[0].MethodDetails.Card != nil {
+					card = *txn.Payments[0].MethodDetails.Card
+				}
+				if apiErr := completeTransaction(h.Store, h.Webhook, txn, card, now); apiErr != nil {
+					respondAPIError(w, r, apiErr)
+					return
+				}
+			}
+			prevEnd := now
+			if sub.CurrentBillingPeriod != nil {
+				prevEnd = sub.CurrentBillingPeriod.EndsAt
+			}
+			if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
+			startBillingPeriod(sub, prevEnd)
+			if sub.FirstBilledAt == nil {
+				// Recovered from a failed end-of-trial charge.
+				sub.FirstBilledAt = &now
+			}
+			for i := range sub.Items {
+				sub.Items[i].TrialDates = nil
+				sub.Items[i].PreviouslyBilledAt = &prevEnd
+			}
+			h.Store.SetSubscription(sub)
+			h.Webhook.Fire("subscription.updated", sub)
+			break
+		}
+
+		errorCode, apiErr := paymentErrorCode(r.URL.Query().Get("error_code"))
+		if apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+		if r.URL.Query().Get("error_code") == "" && requires3DS(h.Store, sub.CustomerID) {
+			errorCode = "authentication_required"
+		}
+		if apiErr := transitionSubscription(sub, "canceled", now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
 		h.Store.SetSubscription(sub)
+		if txn != nil {
+			recordPayment(txn, errorCode, defaultCard(now), now)
+			h.Store.SetTransaction(txn)
+			h.Webhook.Fire("transaction.payment_failed", txn)
+		}
 		h.Webhook.Fire("subscription.canceled", sub)
 
 	case "paused":
 		// paused → active (resume)
-		sub.Status = "active"
-		sub.PausedAt = nil
-		sub.UpdatedAt = now
-		nextBill := addPeriod(now, sub.BillingCycle.Interval, sub.BillingCycle.Frequency)
-		sub.NextBilledAt = &nextBill
-		sub.CurrentBillingPeriod = &models.BillingPeriodDates{
-			StartsAt: now,
-			EndsAt:   nextBill,
+		if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
 		}
+		startBillingPeriod(sub, now)
 		h.Store.SetSubscription(sub)
 		h.Webhook.Fire("subscription.updated", sub)
-
-	default:
-		respondError(w, r, http.StatusConflict, "request_error", "conflict", "Cannot advance subscription in status: "+sub.Status)
-		return
+		h.Webhook.Fire("subscription.resumed", sub)
 	}
 
 	respond(w, r, http.StatusOK, sub)
 }
 
-func (h *AdminHandler) createTransaction(sub *models.Subscription, origin string) {
+func (h *AdminHandler) createTransaction(sub *models.Subscription, origin string) *models.Transaction {
+	txn := subscriptionTransaction(h.Store, sub, sub.CurrentBillingPeriod, origin, "completed", time.Now().UTC())
+	h.Store.SetTransaction(txn)
+	return txn
+}
+
+// createFailedTransaction records a renewal whose payment was declined with
+// errorCode. Like Paddle, the transaction stays past_due so it can be retried.
+// The subscription stays in its current period, but the renewal is for the
+// next one.
+func (h *AdminHandler) createFailedTransaction(sub *models.Subscription, errorCode string) *models.Transaction {
 	now := time.Now().UTC()
+	txn := subscriptionTransaction(h.Store, sub, nextBillingPeriod(sub), "subscription_recurring", "past_due", now)
+	recordPayment(txn, errorCode, defaultCard(now), now)
+	h.Store.SetTransaction(txn)
+	return txn
+}
+
+// pastDueTransaction returns the most recent past_due transaction for sub, or
+// nil if there is none.
+func (h *AdminHandler) pastDueTransaction(sub *models.Subscription) *models.Transaction {
+	var latest *models.Transaction
+	for _, txn := range h.Store.ListTransactions() {
+		if txn.SubscriptionID == nil || *txn.SubscriptionID != sub.ID || txn.Status != "past_due" {
+			continue
+		}
+		if latest == nil || txn.CreatedAt.After(latest.CreatedAt) || (txn.CreatedAt.Equal(latest.CreatedAt) && txn.ID > latest.ID) {
+			latest = txn
+		}
+	}
+	return latest
+}
+
+// checkout simulates a customer paying for items at checkout: a web
+// transaction is created and completed, which creates a subscription for any
+// recurring items.
+func (h *AdminHandler) checkout(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateTransactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.CustomerID == "" || len(req.Items) == 0 {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "customer_id and items are required")
+		return
+	}
+	if _, ok := h.Store.GetCustomer(req.CustomerID); !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Customer not found")
+		return
+	}
+
+	items, currency, apiErr := resolveTransactionItems(h.Store, req.Items, req.CurrencyCode)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	now := time.Now().UTC()
+	customData := req.CustomData
+	if customData == nil {
+		customData = map[string]string{}
+	}
+	discount, apiErr := transactionDiscount(h.Store, req.DiscountID, currency, items, now)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
 	txn := &models.Transaction{
 		ID:             store.NextID("txn"),
-		Status:         "completed",
-		CustomerID:     sub.CustomerID,
-		SubscriptionID: &sub.ID,
-		CurrencyCode:   sub.CurrencyCode,
-		CollectionMode: sub.CollectionMode,
-		Origin:         origin,
-		Items:          make([]models.TransactionItem, 0),
-		BilledAt:       &now,
+		Status:         "ready",
+		CustomerID:     req.CustomerID,
+		AddressID:      req.AddressID,
+		DiscountID:     req.DiscountID,
+		CurrencyCode:   currency,
+		CollectionMode: "automatic",
+		Origin:         "web",
+		Items:          items,
+		Details:        transactionDetails(items, currency, addressCountry(h.Store, req.AddressID), discount),
+		Payments:       make([]models.TransactionPayment, 0),
 		CreatedAt:      now,
 		UpdatedAt:      now,
-		CustomData:     map[string]string{},
+		CustomData:     customData,
 	}
 
-	var totalAmount int
-	for _, item := range sub.Items {
-		txnItem := models.TransactionItem{
-			PriceID:  item.Price.ID,
-			Quantity: item.Quantity,
-			Price:    item.Price,
-			Product:  item.Product,
+	if apiErr := completeTransaction(h.Store, h.Webhook, txn, defaultCard(now), now); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	respond(w, r, http.StatusCreated, txn)
+}
+
+// payTransaction simulates Paddle collecting payment for a ready or billed
+// transaction, completing it.
+func (h *AdminHandler) payTransaction(w http.ResponseWriter, r *http.Request, txnID string) {
+	txn, ok := h.Store.GetTransaction(txnID)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	now := time.Now().UTC()
+	if apiErr := completeTransaction(h.Store, h.Webhook, txn, defaultCard(now), now); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	respond(w, r, http.StatusOK, txn)
+}
+
+// decideAdjustment handles /admin/adjustments/{id}/approve and
+// /admin/adjustments/{id}/reject, standing in for Paddle reviewing a refund.
+func (h *AdminHandler) decideAdjustment(w http.ResponseWriter, r *http.Request, path string) {
+	id, decision, _ := strings.Cut(path, "/")
+	status := map[string]string{"approve": "approved", "reject": "rejected"}[decision]
+	if status == "" {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Admin route not found")
+		return
+	}
+	adj, ok := h.Store.GetAdjustment(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Adjustment not found")
+		return
+	}
+	if apiErr := decideAdjustment(h.Store, h.Webhook, adj, status, time.Now().UTC()); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	respond(w, r, http.StatusOK, adj)
+}
+
+// openChargeback simulates the customer's bank disputing a completed
+// transaction: a chargeback adjustment is recorded and, if requested, the
+// subscription is canceled, as merchants usually do.
+func (h *AdminHandler) openChargeback(w http.ResponseWriter, r *http.Request, txnID string) {
+	txn, ok := h.Store.GetTransaction(txnID)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	var req models.OpenChargebackRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+			return
 		}
-		txn.Items = append(txn.Items, txnItem)
-		totalAmount += parseAmount(item.Price.UnitPrice.Amount) * item.Quantity
+	}
+	if req.Reason == "" {
+		req.Reason = "fraudulent"
+	}
+	if req.Type == "" {
+		req.Type = "full"
 	}
 
-	total := formatAmount(totalAmount)
-	txn.Details = models.TransactionDetails{
-		Totals: models.TransactionTotals{
-			Subtotal:     total,
-			Tax:          "0",
-			Total:        total,
-			GrandTotal:   total,
-			CurrencyCode: sub.CurrencyCode,
-		},
+	now := time.Now().UTC()
+	adj, apiErr := newAdjustment(h.Store, txn, models.CreateAdjustmentRequest{
+		Action:        "chargeback",
+		TransactionID: txn.ID,
+		Reason:        req.Reason,
+		Type:          req.Type,
+		Items:         req.Items,
+	}, now)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
 	}
 
-	h.Store.SetTransaction(txn)
+	// The subscription is canceled on a copy, stored only once the
+	// chargeback is.
+	var sub *models.Subscription
+	if req.CancelSubscription && txn.SubscriptionID != nil {
+		if found, ok := h.Store.GetSubscription(*txn.SubscriptionID); ok && found.Status != "canceled" {
+			canceled := *found
+			if apiErr := transitionSubscription(&canceled, "canceled", now); apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
+			sub = &canceled
+		}
+	}
+
+	if apiErr := recordAdjustment(h.Store, h.Webhook, txn, adj); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	if sub != nil {
+		h.Store.SetSubscription(sub)
+		h.Webhook.Fire("subscription.canceled", sub)
+	}
+	respond(w, r, http.StatusCreated, adj)
 }
 
-func (h *AdminHandler) createFailedTransaction(sub *models.Subscription) *models.Transaction {
+// reverseChargeback simulates the merchant winning a dispute: the chargeback
+// is marked reversed and a chargeback_reverse adjustment gives the money
+// back. A subscription canceled by the chargeback stays canceled.
+func (h *AdminHandler) reverseChargeback(w http.ResponseWriter, r *http.Request, adjID string) {
+	chargeback, ok := h.Store.GetAdjustment(adjID)
+	if !ok || chargeback.Action != "chargeback" {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Chargeback not found")
+		return
+	}
+	if chargeback.Status != "approved" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "adjustment_invalid_status_change",
+			"Only approved chargebacks can be reversed, chargeback is "+chargeback.Status)
+		return
+	}
+	txn, ok := h.Store.GetTransaction(chargeback.TransactionID)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+
 	now := time.Now().UTC()
-	txn := &models.Transaction{
-		ID:             store.NextID("txn"),
-		Status:         "failed",
-		CustomerID:     sub.CustomerID,
-		SubscriptionID: &sub.ID,
-		CurrencyCode:   sub.CurrencyCode,
-		CollectionMode: sub.CollectionMode,
-		Origin:         "subscription_recurring",
-		Items:          make([]models.TransactionItem, 0),
-		CreatedAt:      now,
-		UpdatedAt:      now,
-		CustomData:     map[string]string{},
+	reversal := *chargeback
+	reversal.ID = store.NextID("adj")
+	reversal.Action = "chargeback_reverse"
+	reversal.Reason = "chargeback_won"
+	reversal.Items = make([]models.AdjustmentItem, len(chargeback.Items))
+	for i, item := range chargeback.Items {
+		item.ID = store.NextID("adjitm")
+		reversal.Items[i] = item
 	}
+	reversal.CreatedAt = now
+	reversal.UpdatedAt = now
+
+	chargeback.Status = "reversed"
+	chargeback.UpdatedAt = now
+	h.Store.SetAdjustment(chargeback)
+	h.Webhook.Fire("adjustment.updated", chargeback)
+	// Reversals are always allowed, so this can't fail.
+	recordAdjustment(h.Store, h.Webhook, txn, &reversal)
+	respond(w, r, http.StatusCreated, &reversal)
+}
 
-	var totalAmount int
-	for _, item := range sub.Items {
-		txnItem := models.TransactionItem{
-			PriceID:  item.Price.ID,
-			Quantity: item.Quantity,
-			Price:    item.Price,
-			Product:  item.Product,
+// createPaymentRule adds a rule for the simulated payment processor, for
+// example to require 3-D Secure for a customer's payments.
+func (h *AdminHandler) createPaymentRule(w http.ResponseWriter, r *http.Request) {
+	var req models.CreatePaymentRuleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.CustomerID != nil {
+		if _, ok := h.Store.GetCustomer(*req.CustomerID); !ok {
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Customer not found")
+			return
 		}
-		txn.Items = append(txn.Items, txnItem)
-		totalAmount += parseAmount(item.Price.UnitPrice.Amount) * item.Quantity
 	}
 
-	total := formatAmount(totalAmount)
-	txn.Details = models.TransactionDetails{
-		Totals: models.TransactionTotals{
-			Subtotal:     total,
-			Tax:          "0",
-			Total:        total,
-			GrandTotal:   total,
-			CurrencyCode: sub.CurrencyCode,
-		},
+	rule := &models.PaymentRule{
+		ID:         store.NextID("pmrule"),
+		CustomerID: req.CustomerID,
+		Require3DS: req.Require3DS,
+		CreatedAt:  time.Now().UTC(),
 	}
+	h.Store.SetPaymentRule(rule)
+	respond(w, r, http.StatusCreated, rule)
+}
 
-	h.Store.SetTransaction(txn)
-	return txn
+func (h *AdminHandler) deletePaymentRule(w http.ResponseWriter, r *http.Request, id string) {
+	if !h.Store.DeletePaymentRule(id) {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Payment rule not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *AdminHandler) triggerWebhook(w http.ResponseWriter, r *http.Request, eventType string) {
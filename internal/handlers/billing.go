@@ -0,0 +1,611 @@
+package handlers
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+	"github.com/vlah-software-house/paddle-api-mock/internal/payout"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+)
+
+// subscriptionTransaction builds (but does not store) a transaction billing
+// the current items of sub for period, which picks the subscription discount
+// that applies. Completed and past_due transactions are billed
+// straight away, getting a billed_at date and an invoice number; completed
+// ones also get a captured payment on the default card.
+func subscriptionTransaction(s *store.Store, sub *models.Subscription, period *models.BillingPeriodDates, origin, status string, now time.Time) *models.Transaction {
+	txn := &models.Transaction{
+		ID:             store.NextID("txn"),
+		Status:         status,
+		CustomerID:     sub.CustomerID,
+		SubscriptionID: &sub.ID,
+		AddressID:      sub.AddressID,
+		CurrencyCode:   sub.CurrencyCode,
+		CollectionMode: sub.CollectionMode,
+		Origin:         origin,
+		BillingPeriod:  copyPeriod(period),
+		Items:          subscriptionItems(sub),
+		Payments:       make([]models.TransactionPayment, 0),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		CustomData:     map[string]string{},
+	}
+	if status == "completed" || status == "past_due" {
+		invoiceNumber := store.NextInvoiceNumber()
+		txn.BilledAt = &now
+		txn.InvoiceNumber = &invoiceNumber
+	}
+
+	discount := activeSubscriptionDiscount(s, sub, period)
+	if discount != nil {
+		txn.DiscountID = &discount.ID
+	}
+	txn.Details = transactionDetails(txn.Items, sub.CurrencyCode, addressCountry(s, sub.AddressID), discount)
+	if status == "completed" {
+		recordPayment(txn, "", defaultCard(now), now)
+	}
+	setPayoutTotals(txn)
+	return txn
+}
+
+// copyPeriod returns a copy of period, or nil, so a transaction keeps the
+// period it billed as its subscription moves on.
+func copyPeriod(period *models.BillingPeriodDates) *models.BillingPeriodDates {
+	if period == nil {
+		return nil
+	}
+	copied := *period
+	return &copied
+}
+
+// subscriptionItems returns the current items of sub as transaction items.
+func subscriptionItems(sub *models.Subscription) []models.TransactionItem {
+	items := make([]models.TransactionItem, 0, len(sub.Items))
+	for _, item := range sub.Items {
+		items = append(items, models.TransactionItem{
+			PriceID:  item.Price.ID,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+			Product:  item.Product,
+			Trial:    item.Status == "trialing",
+		})
+	}
+	return items
+}
+
+// prorationTransaction bills an item change on an active subscription
+// according to Paddle's proration_billing_mode, returning nil when nothing is
+// billed now. With prorated_immediately the new items are charged for the rest
+// of the current period and the unused time on oldItems is credited.
+func prorationTransaction(s *store.Store, sub *models.Subscription, oldItems []models.SubscriptionItem, mode string, now time.Time) *models.Transaction {
+	if mode != "prorated_immediately" && mode != "full_immediately" {
+		return nil
+	}
+	if sub.Status != "active" || sub.CurrentBillingPeriod == nil {
+		return nil
+	}
+
+	txn := subscriptionTransaction(s, sub, sub.CurrentBillingPeriod, "subscription_update", "completed", now)
+	if mode == "full_immediately" {
+		return txn
+	}
+
+	period := sub.CurrentBillingPeriod
+	rate := periodRemaining(period, now)
+	proration := &models.Proration{
+		Rate:          formatRate(rate),
+		RatRate:       rate,
+		BillingPeriod: models.BillingPeriodDates{StartsAt: now, EndsAt: period.EndsAt},
+	}
+
+	country := addressCountry(s, sub.AddressID)
+	for i := range txn.Items {
+		txn.Items[i].Proration = proration
+	}
+	credited := make([]models.TransactionItem, 0, len(oldItems))
+	for _, item := range oldItems {
+		credited = append(credited, models.TransactionItem{
+			PriceID:   item.Price.ID,
+			Quantity:  item.Quantity,
+			Proration: proration,
+			Price:     item.Price,
+		})
+	}
+
+	// Both sides are discounted alike, so the credit is what was paid.
+	discount := activeSubscriptionDiscount(s, sub, period)
+	txn.Details = transactionDetails(txn.Items, sub.CurrencyCode, country, discount)
+	applyCredit(&txn.Details, storedAmount(transactionDetails(credited, sub.CurrencyCode, country, discount).Totals.Total))
+	setPayoutTotals(txn)
+	txn.Payments = txn.Payments[:0]
+	if storedAmount(txn.Details.Totals.GrandTotal) > 0 {
+		recordPayment(txn, "", defaultCard(now), now)
+	}
+	return txn
+}
+
+// periodRemaining is the part of period left at now, between 0 and 1, worked
+// out exactly from the durations.
+func periodRemaining(period *models.BillingPeriodDates, now time.Time) *big.Rat {
+	length := period.EndsAt.Sub(period.StartsAt)
+	remaining := period.EndsAt.Sub(now)
+	switch {
+	case length <= 0 || remaining <= 0:
+		return new(big.Rat)
+	case remaining >= length:
+		return big.NewRat(1, 1)
+	}
+	return big.NewRat(int64(remaining), int64(length))
+}
+
+// resolveTransactionItems looks up the catalog price for each requested item
+// and checks that every price is in currency, returning the items and the
+// currency. With no currency given, the items take that of the first price.
+// Recurring items with a trial period are trial items, billed at zero, as
+// completing the transaction starts their trial.
+func resolveTransactionItems(s *store.Store, reqs []models.TransactionItemReq, currency string) ([]models.TransactionItem, string, *apiError) {
+	items := make([]models.TransactionItem, 0, len(reqs))
+	lines := make([]money.Amount, 0, len(reqs))
+	for _, item := range reqs {
+		price, ok := s.GetPrice(item.PriceID)
+		if !ok {
+			return nil, "", validationError("Price not found: " + item.PriceID)
+		}
+		qty := item.Quantity
+		if qty == 0 {
+			qty = 1
+		}
+		line, apiErr := checkQuantity(price, qty)
+		if apiErr != nil {
+			return nil, "", apiErr
+		}
+		lines = append(lines, line)
+		txnItem := models.TransactionItem{
+			PriceID:  price.ID,
+			Quantity: qty,
+			Price:    *price,
+			Trial:    price.BillingCycle != nil && price.TrialPeriod != nil,
+		}
+		if prod, ok := s.GetProduct(price.ProductID); ok {
+			txnItem.Product = prod
+		}
+		items = append(items, txnItem)
+	}
+	if apiErr := checkTotal(lines); apiErr != nil {
+		return nil, "", apiErr
+	}
+	prices := make([]models.Price, 0, len(items))
+	for _, item := range items {
+		prices = append(prices, item.Price)
+	}
+	if apiErr := checkRecurringPrices(prices); apiErr != nil {
+		return nil, "", apiErr
+	}
+	if currency == "" && len(items) > 0 {
+		currency = items[0].Price.UnitPrice.CurrencyCode
+	}
+	if apiErr := checkItemCurrency(items, currency); apiErr != nil {
+		return nil, "", apiErr
+	}
+	return items, currency, nil
+}
+
+// checkItemCurrency rejects items priced in a currency other than currency,
+// as their amounts would be read in the wrong minor unit.
+func checkItemCurrency(items []models.TransactionItem, currency string) *apiError {
+	for _, item := range items {
+		if item.Price.UnitPrice.CurrencyCode != currency {
+			return validationError("Price " + item.PriceID + " is in " + item.Price.UnitPrice.CurrencyCode + ", not " + currency)
+		}
+	}
+	return nil
+}
+
+// checkQuantity returns the line total of qty of price, rejecting quantities
+// that are negative or so large that the line total would be out of range.
+func checkQuantity(price *models.Price, qty int) (money.Amount, *apiError) {
+	if qty < 1 {
+		return 0, validationError("quantity must be at least 1")
+	}
+	line, err := storedAmount(price.UnitPrice.Amount).Mul(int64(qty))
+	if err != nil {
+		return 0, validationError("Line total is too large for price " + price.ID)
+	}
+	return line, nil
+}
+
+// checkTotal rejects items whose line totals, with tax at the highest rate
+// the mock charges, would add up to more than money.MaxAmount. With every
+// transaction total in range, the amounts derived from it (credits,
+// adjustments, payout totals) are too.
+func checkTotal(lines []money.Amount) *apiError {
+	total, err := money.Sum(lines...)
+	if err == nil {
+		_, err = money.Sum(total, total.Scale(maxTaxRate(), money.HalfUp))
+	}
+	if err != nil {
+		return validationError("Total of items is too large")
+	}
+	return nil
+}
+
+// storedAmount reads an amount held by the mock: a catalog price or a total
+// it calculated. These were validated or produced by the money package, so
+// they always parse.
+func storedAmount(s string) money.Amount {
+	a, _ := money.Parse(s)
+	return a
+}
+
+// taxRates are the sales tax / VAT rates the mock applies by customer
+// country. Countries not listed are charged no tax.
+var taxRates = map[string]string{
+	"AT": "0.2", "AU": "0.1", "BE": "0.21", "CA": "0.05", "CH": "0.081", "DE": "0.19",
+	"DK": "0.25", "ES": "0.21", "FI": "0.255", "FR": "0.2", "GB": "0.2", "IE": "0.23",
+	"IN": "0.18", "IT": "0.22", "JP": "0.1", "NL": "0.21", "NO": "0.25", "NZ": "0.15",
+	"PL": "0.23", "PT": "0.23", "SE": "0.25",
+}
+
+// taxRate returns the tax rate for a country as a decimal, "0" for countries
+// without tax.
+func taxRate(countryCode string) string {
+	if rate, ok := taxRates[countryCode]; ok {
+		return rate
+	}
+	return "0"
+}
+
+// maxTaxRate returns the highest rate in taxRates.
+func maxTaxRate() *big.Rat {
+	max := new(big.Rat)
+	for _, s := range taxRates {
+		if rate, err := money.ParseRate(s); err == nil && rate.Cmp(max) > 0 {
+			max = rate
+		}
+	}
+	return max
+}
+
+// addressCountry returns the country of the address, or "" if there is none.
+func addressCountry(s *store.Store, addressID *string) string {
+	if addressID == nil {
+		return ""
+	}
+	if address, ok := s.GetAddress(*addressID); ok {
+		return address.CountryCode
+	}
+	return ""
+}
+
+// transactionDetails computes the line items, discount, tax and totals for
+// items, with tax charged at the rate for countryCode. discount may be nil.
+// Every transaction, stored or previewed, is priced through here.
+//
+// Prorated amounts are rounded down and tax is rounded half up, per line item.
+// Discounts come off the prorated price before tax.
+func transactionDetails(items []models.TransactionItem, currency, countryCode string, discount *models.Discount) models.TransactionDetails {
+	return pricedDetails(nil, items, currency, countryCode, discount)
+}
+
+// recalculateDetails prices txn again after a change to its items, address
+// or discount. Line items with the same price and quantity as before keep
+// their IDs.
+func recalculateDetails(txn *models.Transaction, countryCode string, discount *models.Discount) {
+	txn.Details = pricedDetails(txn.Details.LineItems, txn.Items, txn.CurrencyCode, countryCode, discount)
+}
+
+// pricedDetails is transactionDetails, reusing the IDs of the previous line
+// items where they are unchanged.
+func pricedDetails(previous []models.TransactionLineItem, items []models.TransactionItem, currency, countryCode string, discount *models.Discount) models.TransactionDetails {
+	rate := taxRate(countryCode)
+	taxRate, _ := money.ParseRate(rate)
+	details := models.TransactionDetails{
+		TaxRatesUsed: make([]models.TaxRateUsed, 0),
+		LineItems:    make([]models.TransactionLineItem, 0, len(items)),
+	}
+
+	amounts := make([]money.Amount, len(items))
+	for i, item := range items {
+		// Quantities and totals were checked against overflow when the items were
+		// resolved.
+		linePrice, _ := storedAmount(item.Price.UnitPrice.Amount).Mul(int64(item.Quantity))
+		amounts[i] = linePrice.Scale(prorationRate(item), money.Down)
+	}
+	discounts := lineDiscounts(discount, items, amounts)
+
+	var subtotal, discounted, tax money.Amount
+	for i, item := range items {
+		inclusive := item.Price.TaxMode == "internal"
+		unitPrice := storedAmount(item.Price.UnitPrice.Amount).Scale(prorationRate(item), money.Down)
+		unitDiscount := discounts[i].Scale(big.NewRat(1, int64(item.Quantity)), money.Down)
+
+		unitSubtotal, unitDiscounted, unitTax := lineTotals(unitPrice, unitDiscount, taxRate, inclusive)
+		itemSubtotal, itemDiscounted, itemTax := lineTotals(amounts[i], discounts[i], taxRate, inclusive)
+
+		line := models.TransactionLineItem{
+			ID:         lineItemID(previous, i, item),
+			PriceID:    item.PriceID,
+			Quantity:   item.Quantity,
+			Proration:  item.Proration,
+			TaxRate:    rate,
+			UnitTotals: lineItemTotals(unitSubtotal, unitDiscounted, unitTax),
+			Totals:     lineItemTotals(itemSubtotal, itemDiscounted, itemTax),
+			Product:    item.Product,
+		}
+		details.LineItems = append(details.LineItems, line)
+		addTaxRateUsed(&details, line)
+
+		subtotal += itemSubtotal
+		discounted += itemDiscounted
+		tax += itemTax
+	}
+
+	total := (subtotal - discounted + tax).String()
+	details.Totals = models.TransactionTotals{
+		Subtotal:        subtotal.String(),
+		Discount:        discounted.String(),
+		Tax:             tax.String(),
+		Total:           total,
+		Credit:          "0",
+		CreditToBalance: "0",
+		Balance:         total,
+		GrandTotal:      total,
+		CurrencyCode:    currency,
+	}
+	details.AdjustedTotals = models.AdjustedTotals{
+		Subtotal:     (subtotal - discounted).String(),
+		Tax:          details.Totals.Tax,
+		Total:        total,
+		GrandTotal:   total,
+		CurrencyCode: currency,
+	}
+	return details
+}
+
+// lineItemID returns the ID of the line item for item, the i-th item of a
+// transaction: the ID of the previous line item in that place if it has the
+// same price and quantity, otherwise a new one.
+func lineItemID(previous []models.TransactionLineItem, i int, item models.TransactionItem) string {
+	if i < len(previous) && previous[i].PriceID == item.PriceID && previous[i].Quantity == item.Quantity {
+		return previous[i].ID
+	}
+	return store.NextID("txnitm")
+}
+
+// prorationRate is the part of its price an item is charged: 0 for trial
+// items, and 1 unless the item is prorated.
+func prorationRate(item models.TransactionItem) *big.Rat {
+	if item.Trial {
+		return new(big.Rat)
+	}
+	if item.Proration != nil {
+		if item.Proration.RatRate != nil {
+			return item.Proration.RatRate
+		}
+		if rate, err := money.ParseRate(item.Proration.Rate); err == nil {
+			return rate
+		}
+	}
+	return big.NewRat(1, 1)
+}
+
+// lineTotals prices amount with discount taken off before tax. The subtotal
+// is before the discount; for tax-inclusive prices the discount is reported
+// net of tax, like the subtotal.
+func lineTotals(amount, discount money.Amount, rate *big.Rat, inclusive bool) (subtotal, discounted, tax money.Amount) {
+	subtotal, _ = lineTax(amount, rate, inclusive)
+	net, tax := lineTax(amount-discount, rate, inclusive)
+	return subtotal, subtotal - net, tax
+}
+
+// lineTax splits amount into subtotal and tax. Tax-inclusive prices already
+// contain the tax; otherwise it is added on top.
+func lineTax(amount money.Amount, rate *big.Rat, inclusive bool) (subtotal, tax money.Amount) {
+	if inclusive {
+		net := new(big.Rat).Inv(new(big.Rat).Add(big.NewRat(1, 1), rate))
+		subtotal = amount.Scale(net, money.HalfUp)
+		return subtotal, amount - subtotal
+	}
+	return amount, amount.Scale(rate, money.HalfUp)
+}
+
+func lineItemTotals(subtotal, discount, tax money.Amount) models.LineItemTotals {
+	return models.LineItemTotals{
+		Subtotal: subtotal.String(),
+		Discount: discount.String(),
+		Tax:      tax.String(),
+		Total:    (subtotal - discount + tax).String(),
+	}
+}
+
+// addTaxRateUsed adds line to the tax_rates_used entry for its rate.
+func addTaxRateUsed(details *models.TransactionDetails, line models.TransactionLineItem) {
+	for i, used := range details.TaxRatesUsed {
+		if used.TaxRate != line.TaxRate {
+			continue
+		}
+		t := &details.TaxRatesUsed[i].Totals
+		subtotal := storedAmount(t.Subtotal) + storedAmount(line.Totals.Subtotal)
+		discount := storedAmount(t.Discount) + storedAmount(line.Totals.Discount)
+		tax := storedAmount(t.Tax) + storedAmount(line.Totals.Tax)
+		*t = lineItemTotals(subtotal, discount, tax)
+		return
+	}
+	details.TaxRatesUsed = append(details.TaxRatesUsed, models.TaxRateUsed{
+		TaxRate: line.TaxRate,
+		Totals:  line.Totals,
+	})
+}
+
+// applyCredit deducts credit (for example unused time on replaced items)
+// from what the customer pays, up to the transaction total.
+func applyCredit(details *models.TransactionDetails, credit money.Amount) {
+	total := storedAmount(details.Totals.Total)
+	if credit > total {
+		credit = total
+	}
+	grandTotal := (total - credit).String()
+	details.Totals.Credit = credit.String()
+	details.Totals.GrandTotal = grandTotal
+	details.Totals.Balance = grandTotal
+	details.AdjustedTotals.GrandTotal = grandTotal
+}
+
+// payoutConfig is the fee and exchange-rate setup used for payout totals.
+var payoutConfig = payout.Default()
+
+// SetPayoutConfig replaces the fee and exchange-rate setup. It is called once
+// at startup, before the server handles requests.
+func SetPayoutConfig(c payout.Config) {
+	payoutConfig = c
+}
+
+// setPayoutTotals fills in details.payout_totals once txn is billed: its
+// totals converted to the balance currency, Paddle's fee, and the seller's
+// earnings after tax and the fee. It is left null for unbilled transactions
+// and currencies without an exchange rate. The fee and earnings are also
+// given in the totals when the payout currency is the transaction's.
+func setPayoutTotals(txn *models.Transaction) {
+	setBalance(txn)
+	totals := txn.Details.Totals
+	txn.Details.Totals.Fee = nil
+	txn.Details.Totals.Earnings = nil
+	rate, ok := payoutConfig.ExchangeRate(totals.CurrencyCode)
+	if txn.BilledAt == nil || !ok {
+		txn.Details.PayoutTotals = nil
+		return
+	}
+
+	convert := func(amount string) money.Amount {
+		return payoutConfig.Convert(storedAmount(amount), totals.CurrencyCode)
+	}
+	grandTotal := convert(totals.GrandTotal)
+	tax := convert(totals.Tax)
+	fee := payoutConfig.Fee(grandTotal)
+	txn.Details.PayoutTotals = &models.PayoutTotals{
+		Subtotal:     convert(totals.Subtotal).String(),
+		Discount:     convert(totals.Discount).String(),
+		Tax:          tax.String(),
+		Total:        convert(totals.Total).String(),
+		Credit:       convert(totals.Credit).String(),
+		GrandTotal:   grandTotal.String(),
+		Fee:          fee.String(),
+		Earnings:     (grandTotal - tax - fee).String(),
+		ExchangeRate: formatRate(rate),
+		CurrencyCode: payoutConfig.Currency,
+	}
+	if payoutConfig.Currency == totals.CurrencyCode {
+		txn.Details.Totals.Fee = &txn.Details.PayoutTotals.Fee
+		txn.Details.Totals.Earnings = &txn.Details.PayoutTotals.Earnings
+	}
+}
+
+// setBalance sets what is left to pay on txn: its grand total until it is
+// paid.
+func setBalance(txn *models.Transaction) {
+	txn.Details.Totals.Balance = txn.Details.Totals.GrandTotal
+	if txn.Status == "paid" || txn.Status == "completed" {
+		txn.Details.Totals.Balance = "0"
+	}
+}
+
+// formatRate writes an exchange rate as a decimal, to at most 10 places.
+func formatRate(rate *big.Rat) string {
+	s := strings.TrimRight(rate.FloatString(10), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// paymentErrorCodes are the error codes Paddle reports on failed payment
+// attempts.
+var paymentErrorCodes = map[string]bool{
+	"already_canceled":                true,
+	"already_refunded":                true,
+	"authentication_failed":           true,
+	"authentication_required":         true,
+	"blocked_card":                    true,
+	"canceled":                        true,
+	"declined":                        true,
+	"declined_not_retryable":          true,
+	"expired_card":                    true,
+	"fraud":                           true,
+	"invalid_amount":                  true,
+	"invalid_payment_details":         true,
+	"issuer_unavailable":              true,
+	"not_enough_balance":              true,
+	"preferred_network_not_supported": true,
+	"psp_error":                       true,
+	"redacted_payment_method":         true,
+	"system_error":                    true,
+	"transaction_not_permitted":       true,
+	"unknown":                         true,
+}
+
+// paymentErrorCode validates a requested decline code. An empty code means
+// "declined". Paddle reports insufficient funds as not_enough_balance, so the
+// more common name is accepted as an alias.
+func paymentErrorCode(code string) (string, *apiError) {
+	switch code {
+	case "":
+		return "declined", nil
+	case "insufficient_funds":
+		return "not_enough_balance", nil
+	}
+	if !paymentErrorCodes[code] {
+		return "", validationError("Unknown payment error_code: " + code)
+	}
+	return code, nil
+}
+
+// requires3DS reports whether a payment rule makes payments by customerID
+// need 3-D Secure authentication.
+func requires3DS(s *store.Store, customerID string) bool {
+	for _, rule := range s.ListPaymentRules() {
+		if rule.Require3DS && (rule.CustomerID == nil || *rule.CustomerID == customerID) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCard is the saved card used for payments that don't specify one.
+func defaultCard(now time.Time) models.PaymentCard {
+	return models.PaymentCard{
+		Type:        "visa",
+		Last4:       "4242",
+		ExpiryMonth: 12,
+		ExpiryYear:  now.Year() + 3,
+	}
+}
+
+// recordPayment adds a card payment attempt for the grand total of txn.
+// Attempts are listed newest first, as Paddle does. An empty errorCode
+// records a captured payment.
+func recordPayment(txn *models.Transaction, errorCode string, card models.PaymentCard, now time.Time) {
+	// Retries charge the same saved payment method.
+	methodID := store.NewUUID()
+	if len(txn.Payments) > 0 {
+		methodID = txn.Payments[0].StoredPaymentMethodID
+	}
+	payment := models.TransactionPayment{
+		PaymentAttemptID:      store.NewUUID(),
+		StoredPaymentMethodID: methodID,
+		Amount:                txn.Details.Totals.GrandTotal,
+		Status:                "captured",
+		MethodDetails: models.PaymentMethodDetails{
+			Type: "card",
+			Card: &card,
+		},
+		CreatedAt: now,
+	}
+	if errorCode != "" {
+		payment.Status = "error"
+		payment.ErrorCode = &errorCode
+	} else {
+		payment.CapturedAt = &now
+	}
+	txn.Payments = append([]models.TransactionPayment{payment}, txn.Payments...)
+	txn.UpdatedAt = now
+}
@@ -0,0 +1,676 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+// completeTransaction records a captured payment on card for txn, moving it
+// through paid to completed, and stores it. If txn bills recurring prices and
+// is not yet linked to a subscription, a subscription is created from those
+// items, as Paddle does when a checkout completes.
+//
+// Events fire in Paddle's order: transaction.paid, transaction.completed,
+// subscription.created, then subscription.activated (or subscription.trialing
+// for trials).
+func completeTransaction(s *store.Store, n *webhook.Notifier, txn *models.Transaction, card models.PaymentCard, now time.Time) *apiError {
+	if txn.Status != "ready" && txn.Status != "billed" && txn.Status != "past_due" {
+		return &apiError{
+			Status: http.StatusBadRequest,
+			Type:   "request_error",
+			Code:   "transaction_not_ready",
+			Detail: "Transaction must be ready, billed or past_due to be paid, transaction is " + txn.Status,
+		}
+	}
+
+	var sub *models.Subscription
+	if txn.SubscriptionID == nil {
+		req := models.CreateSubscriptionRequest{
+			CustomerID:     txn.CustomerID,
+			AddressID:      txn.AddressID,
+			CurrencyCode:   txn.CurrencyCode,
+			CollectionMode: txn.CollectionMode,
+			CustomData:     txn.CustomData,
+		}
+		for _, item := range txn.Items {
+			if item.Price.BillingCycle == nil {
+				continue
+			}
+			req.Items = append(req.Items, models.CreateSubItemReq{
+				PriceID:  item.PriceID,
+				Quantity: item.Quantity,
+			})
+		}
+		if len(req.Items) > 0 {
+			var apiErr *apiError
+			sub, apiErr = newSubscription(s, req, now)
+			if apiErr != nil {
+				return apiErr
+			}
+			txn.SubscriptionID = &sub.ID
+			txn.BillingPeriod = copyPeriod(sub.CurrentBillingPeriod)
+			// The transaction's discount carries over to the
+			// subscription, counted as one use below.
+			if d := appliedDiscount(s, txn.DiscountID); d != nil {
+				sub.Discount = newSubscriptionDiscount(d, sub, firstBillingDate(sub, now))
+			}
+		}
+	}
+
+	// A discount is counted as used when the transaction completes, so
+	// abandoned checkouts don't use it up. Renewals use their subscription's
+	// discount, counted when the subscription got it.
+	if txn.DiscountID != nil && (sub != nil || txn.SubscriptionID == nil) {
+		if apiErr := redeemDiscount(s, *txn.DiscountID, now); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	if apiErr := transitionTransaction(txn, "paid", now); apiErr != nil {
+		return apiErr
+	}
+	recordPayment(txn, "", card, now)
+	s.SetTransaction(txn)
+	n.Fire("transaction.paid", txn)
+
+	if apiErr := transitionTransaction(txn, "completed", now); apiErr != nil {
+		return apiErr
+	}
+	s.SetTransaction(txn)
+	n.Fire("transaction.completed", txn)
+
+	if sub != nil {
+		s.SetSubscription(sub)
+		n.Fire("subscription.created", sub)
+		if sub.Status == "trialing" {
+			n.Fire("subscription.trialing", sub)
+		} else {
+			n.Fire("subscription.activated", sub)
+		}
+	}
+	return nil
+}
+
+// CheckoutHandler serves the hosted checkout at /checkout?_ptxn={transaction_id},
+// the page a transaction's checkout.url opens. It shows the items and totals
+// and takes one of the well-known sandbox test cards, so browser tests can pay
+// without real Paddle.
+type CheckoutHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+	BaseURL string
+}
+
+// testCard is a sandbox card number and what happens when it is used.
+type testCard struct {
+	Number    string
+	Brand     string
+	ErrorCode string // empty if the payment succeeds
+	ThreeDS   bool   // the issuer asks for a 3-D Secure challenge
+	Outcome   string
+}
+
+// testCards are the card numbers the checkout accepts, as in Paddle's sandbox.
+var testCards = []testCard{
+	{"4242424242424242", "visa", "", false, "Payment succeeds"},
+	{"4000056655665556", "visa", "", false, "Payment succeeds (debit)"},
+	{"5555555555554444", "mastercard", "", false, "Payment succeeds"},
+	{"378282246310005", "american_express", "", false, "Payment succeeds"},
+	{"4000002760003184", "visa", "", true, "3-D Secure challenge, then succeeds if passed"},
+	{"4000008260003178", "visa", "not_enough_balance", true, "3-D Secure challenge, then declined for insufficient funds"},
+	{"4000000000000002", "visa", "declined", false, "Declined"},
+	{"4000000000009995", "visa", "not_enough_balance", false, "Declined, insufficient funds"},
+	{"4000000000000069", "visa", "expired_card", false, "Declined, expired card"},
+	{"4000000000000119", "visa", "system_error", false, "Processing error"},
+}
+
+func (h *CheckoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/checkout")
+	path = strings.Trim(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		h.show(w, r)
+	case path == "" && r.Method == http.MethodPost:
+		h.submit(w, r)
+	case path == "transactions":
+		h.createTransaction(w, r)
+	case path == "":
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+	default:
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+	}
+}
+
+func (h *CheckoutHandler) show(w http.ResponseWriter, r *http.Request) {
+	txn, ok := h.Store.GetTransaction(r.URL.Query().Get("_ptxn"))
+	if !ok {
+		renderCheckout(w, http.StatusNotFound, checkoutPage{Error: "Transaction not found"})
+		return
+	}
+	if apiErr := checkSuccessURL(r.URL.Query().Get("success_url")); apiErr != nil {
+		renderCheckout(w, apiErr.Status, checkoutPage{Error: apiErr.Detail})
+		return
+	}
+	page := newCheckoutPage(txn, r)
+	if page.Embed {
+		page.Event = "checkout.loaded"
+	}
+	renderCheckout(w, http.StatusOK, page)
+}
+
+// createTransaction creates a transaction for Paddle.Checkout.open({items}).
+// paddle.js calls it from the merchant's page, so like Paddle's client-side
+// endpoints it needs no API key and allows any origin. The customer and
+// address are collected by the checkout page.
+func (h *CheckoutHandler) createTransaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	// Like paddle.js, a discount can be given by ID or by the code a
+	// customer enters.
+	var req struct {
+		models.CreateTransactionRequest
+		DiscountCode string `json:"discount_code,omitempty"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if len(req.Items) == 0 {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "items is required")
+		return
+	}
+	items, currency, apiErr := resolveTransactionItems(h.Store, req.Items, req.CurrencyCode)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	customData := req.CustomData
+	if customData == nil {
+		customData = map[string]string{}
+	}
+
+	now := time.Now().UTC()
+	discountID := req.DiscountID
+	if req.DiscountCode != "" {
+		d, ok := discountByCode(h.Store, req.DiscountCode)
+		if !ok {
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Discount code not found: "+req.DiscountCode)
+			return
+		}
+		discountID = &d.ID
+	}
+	discount, apiErr := transactionDiscount(h.Store, discountID, currency, items, now)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	txn := &models.Transaction{
+		ID:             store.NextID("txn"),
+		Status:         "draft",
+		DiscountID:     discountID,
+		CurrencyCode:   currency,
+		CollectionMode: "automatic",
+		Origin:         "web",
+		Items:          items,
+		Details:        transactionDetails(items, currency, "", discount),
+		Payments:       make([]models.TransactionPayment, 0),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		CustomData:     customData,
+	}
+	url := checkoutURL(h.BaseURL, txn.ID)
+	txn.Checkout = &models.TransactionCheckout{URL: &url}
+
+	h.Store.SetTransaction(txn)
+	h.Webhook.Fire("transaction.created", txn)
+	respond(w, r, http.StatusCreated, txn)
+}
+
+func (h *CheckoutHandler) submit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderCheckout(w, http.StatusBadRequest, checkoutPage{Error: "Invalid form submission"})
+		return
+	}
+	txn, ok := h.Store.GetTransaction(r.PostFormValue("_ptxn"))
+	if !ok {
+		renderCheckout(w, http.StatusNotFound, checkoutPage{Error: "Transaction not found"})
+		return
+	}
+	if apiErr := checkSuccessURL(r.FormValue("success_url")); apiErr != nil {
+		renderCheckout(w, apiErr.Status, checkoutPage{Error: apiErr.Detail})
+		return
+	}
+
+	fail := func(status int, msg string) {
+		page := newCheckoutPage(txn, r)
+		page.Error = msg
+		renderCheckout(w, status, page)
+	}
+
+	if txn.Status != "draft" && txn.Status != "ready" {
+		fail(http.StatusConflict, "This transaction is "+txn.Status+" and can no longer be paid")
+		return
+	}
+
+	now := time.Now().UTC()
+	var collected *checkoutCustomer
+	if txn.CustomerID == "" || txn.AddressID == nil {
+		var apiErr *apiError
+		collected, apiErr = readCheckoutCustomer(h.Store, txn, r.PostFormValue("email"), r.PostFormValue("country"))
+		if apiErr != nil {
+			fail(apiErr.Status, apiErr.Detail)
+			return
+		}
+	}
+
+	card, match, apiErr := readTestCard(r.PostFormValue("card_number"), r.PostFormValue("card_name"), r.PostFormValue("card_expiry"), now)
+	if apiErr != nil {
+		fail(apiErr.Status, apiErr.Detail)
+		return
+	}
+	// The customer and address are only stored once the whole form is valid.
+	if collected != nil {
+		h.attachCustomer(txn, collected, now)
+	}
+
+	// Cards that need 3-D Secure get the mock challenge first, which posts
+	// the card back with challenge=pass or challenge=fail.
+	errorCode := match.ErrorCode
+	switch r.PostFormValue("challenge") {
+	case "":
+		if match.Number != "" && (match.ThreeDS || requires3DS(h.Store, txn.CustomerID)) {
+			page := newCheckoutPage(txn, r)
+			page.Challenge = true
+			renderCheckout(w, http.StatusOK, page)
+			return
+		}
+	case "pass":
+	default:
+		errorCode = "authentication_failed"
+	}
+
+	if errorCode != "" {
+		recordPayment(txn, errorCode, card, now)
+		h.Store.SetTransaction(txn)
+		h.Webhook.Fire("transaction.payment_failed", txn)
+		page := newCheckoutPage(txn, r)
+		page.Error = "Payment failed: " + errorCode
+		if page.Embed {
+			page.Event = "checkout.payment.failed"
+		}
+		renderCheckout(w, http.StatusPaymentRequired, page)
+		return
+	}
+
+	if apiErr := completeTransaction(h.Store, h.Webhook, txn, card, now); apiErr != nil {
+		fail(apiErr.Status, apiErr.Detail)
+		return
+	}
+
+	page := newCheckoutPage(txn, r)
+	if page.Embed {
+		// paddle.js redirects the merchant's page itself.
+		page.Event = "checkout.completed"
+	} else if page.SuccessURL != "" {
+		http.Redirect(w, r, page.SuccessURL, http.StatusSeeOther)
+		return
+	}
+	renderCheckout(w, http.StatusOK, page)
+}
+
+// checkSuccessURL rejects a success_url the checkout can't safely redirect
+// to: anything but an absolute http or https URL. An empty one is allowed.
+func checkSuccessURL(raw string) *apiError {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return validationError("success_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// checkoutCustomer is the customer and address that checkout collects when
+// the transaction was created without them. customer is nil if the
+// transaction already has one, and new unless it was matched by email.
+type checkoutCustomer struct {
+	customer    *models.Customer
+	newCustomer bool
+	country     string
+}
+
+// readCheckoutCustomer validates the email and country entered at checkout
+// for txn, without storing anything. Customers are matched by email, as
+// Paddle does.
+func readCheckoutCustomer(s *store.Store, txn *models.Transaction, email, country string) (*checkoutCustomer, *apiError) {
+	collected := &checkoutCustomer{country: strings.ToUpper(strings.TrimSpace(country))}
+	if len(collected.country) != 2 {
+		return nil, validationError("Enter a two-letter country code")
+	}
+	if txn.CustomerID != "" {
+		return collected, nil
+	}
+
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return nil, validationError("Enter a valid email address")
+	}
+	for _, c := range s.ListCustomers() {
+		if strings.EqualFold(c.Email, email) {
+			collected.customer = c
+			return collected, nil
+		}
+	}
+	collected.customer = &models.Customer{
+		Email:      email,
+		Locale:     "en",
+		Status:     "active",
+		CustomData: map[string]string{},
+	}
+	collected.newCustomer = true
+	return collected, nil
+}
+
+// attachCustomer stores the customer and address collected by checkout and
+// fills them in on txn.
+func (h *CheckoutHandler) attachCustomer(txn *models.Transaction, collected *checkoutCustomer, now time.Time) {
+	if customer := collected.customer; customer != nil {
+		if collected.newCustomer {
+			customer.ID = store.NextID("ctm")
+			customer.CreatedAt = now
+			customer.UpdatedAt = now
+			h.Store.SetCustomer(customer)
+			h.Webhook.Fire("customer.created", customer)
+		}
+		txn.CustomerID = customer.ID
+	}
+
+	address := &models.Address{
+		ID:          store.NextID("add"),
+		CustomerID:  txn.CustomerID,
+		CountryCode: collected.country,
+		Status:      "active",
+		CustomData:  map[string]string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	h.Store.SetAddress(address)
+	h.Webhook.Fire("address.created", address)
+	txn.AddressID = &address.ID
+
+	prevStatus := txn.Status
+	recalculateDetails(txn, collected.country, appliedDiscount(h.Store, txn.DiscountID))
+	txn.Status = transactionReadyStatus(txn)
+	txn.UpdatedAt = now
+	h.Store.SetTransaction(txn)
+	h.Webhook.Fire("transaction.updated", txn)
+	if txn.Status != prevStatus {
+		h.Webhook.Fire("transaction."+txn.Status, txn)
+	}
+}
+
+// readTestCard validates the submitted card against the sandbox test cards.
+// It returns the card details and the matching test card. A card past its
+// expiry date is returned with no Number and the expired_card error code, so
+// it declines without a 3-D Secure challenge.
+func readTestCard(number, name, expiry string, now time.Time) (models.PaymentCard, testCard, *apiError) {
+	number = strings.NewReplacer(" ", "", "-", "").Replace(number)
+	var match *testCard
+	for i := range testCards {
+		if testCards[i].Number == number {
+			match = &testCards[i]
+			break
+		}
+	}
+	if match == nil {
+		return models.PaymentCard{}, testCard{}, validationError("Use one of the test card numbers listed below")
+	}
+
+	var month, year int
+	if _, err := fmt.Sscanf(strings.TrimSpace(expiry), "%d/%d", &month, &year); err != nil || month < 1 || month > 12 {
+		return models.PaymentCard{}, testCard{}, validationError("Enter the expiry date as MM/YY")
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	card := models.PaymentCard{
+		Type:           match.Brand,
+		Last4:          number[len(number)-4:],
+		ExpiryMonth:    month,
+		ExpiryYear:     year,
+		CardholderName: strings.TrimSpace(name),
+	}
+	if year < now.Year() || (year == now.Year() && month < int(now.Month())) {
+		return card, testCard{ErrorCode: "expired_card"}, nil
+	}
+	return card, *match, nil
+}
+
+// checkoutPage is the data rendered by checkoutTemplate.
+type checkoutPage struct {
+	Transaction   *models.Transaction
+	Lines         []checkoutLine
+	Subtotal      string
+	Discount      string
+	Tax           string
+	Credit        string
+	Total         string
+	NeedsCustomer bool
+	NeedsAddress  bool
+	Paid          bool
+	Email         string
+	Country       string
+	SuccessURL    string
+	Error         string
+	TestCards     []testCard
+
+	// Embed is set when the page is shown in the paddle.js overlay. Event,
+	// if set, is posted to the parent window with EventData.
+	Embed     bool
+	Event     string
+	EventData checkoutEventData
+
+	// Challenge shows the mock 3-D Secure challenge for the submitted card.
+	Challenge  bool
+	CardNumber string
+	CardName   string
+	CardExpiry string
+}
+
+type checkoutLine struct {
+	Description string
+	Quantity    int
+	Amount      string
+}
+
+// checkoutEventData is the data passed to paddle.js eventCallback, a subset of
+// what Paddle sends.
+type checkoutEventData struct {
+	TransactionID string                     `json:"transaction_id"`
+	Status        string                     `json:"status"`
+	CustomerID    string                     `json:"customer_id,omitempty"`
+	CurrencyCode  string                     `json:"currency_code"`
+	Items         []checkoutEventItem        `json:"items"`
+	Totals        models.TransactionTotals   `json:"totals"`
+	Payment       *models.TransactionPayment `json:"payment,omitempty"`
+	CustomData    map[string]string          `json:"custom_data"`
+}
+
+type checkoutEventItem struct {
+	PriceID     string                `json:"price_id"`
+	ProductName string                `json:"product_name,omitempty"`
+	Quantity    int                   `json:"quantity"`
+	Totals      models.LineItemTotals `json:"totals"`
+}
+
+// newCheckoutPage builds the page for txn. The customer's entries and the
+// embed and success_url options are carried over from r, so they survive a
+// failed submission.
+func newCheckoutPage(txn *models.Transaction, r *http.Request) checkoutPage {
+	currency := txn.Details.Totals.CurrencyCode
+	page := checkoutPage{
+		Transaction:   txn,
+		Subtotal:      displayAmount(txn.Details.Totals.Subtotal, currency),
+		Tax:           displayAmount(txn.Details.Totals.Tax, currency),
+		Total:         displayAmount(txn.Details.Totals.GrandTotal, currency),
+		NeedsCustomer: txn.CustomerID == "",
+		NeedsAddress:  txn.AddressID == nil,
+		Paid:          txn.Status == "paid" || txn.Status == "completed",
+		Email:         r.FormValue("email"),
+		Country:       r.FormValue("country"),
+		SuccessURL:    r.FormValue("success_url"),
+		TestCards:     testCards,
+		Embed:         r.FormValue("embed") == "1",
+		CardNumber:    r.PostFormValue("card_number"),
+		CardName:      r.PostFormValue("card_name"),
+		CardExpiry:    r.PostFormValue("card_expiry"),
+		EventData: checkoutEventData{
+			TransactionID: txn.ID,
+			Status:        txn.Status,
+			CustomerID:    txn.CustomerID,
+			CurrencyCode:  txn.CurrencyCode,
+			Items:         make([]checkoutEventItem, 0, len(txn.Details.LineItems)),
+			Totals:        txn.Details.Totals,
+			CustomData:    txn.CustomData,
+		},
+	}
+	if len(txn.Payments) > 0 {
+		page.EventData.Payment = &txn.Payments[0]
+	}
+	if storedAmount(txn.Details.Totals.Discount) > 0 {
+		page.Discount = displayAmount(txn.Details.Totals.Discount, currency)
+	}
+	if storedAmount(txn.Details.Totals.Credit) > 0 {
+		page.Credit = displayAmount(txn.Details.Totals.Credit, currency)
+	}
+	for _, line := range txn.Details.LineItems {
+		page.Lines = append(page.Lines, checkoutLine{
+			Description: invoiceDescription(txn, line),
+			Quantity:    line.Quantity,
+			Amount:      displayAmount(line.Totals.Subtotal, currency),
+		})
+		item := checkoutEventItem{PriceID: line.PriceID, Quantity: line.Quantity, Totals: line.Totals}
+		if line.Product != nil {
+			item.ProductName = line.Product.Name
+		}
+		page.EventData.Items = append(page.EventData.Items, item)
+	}
+	return page
+}
+
+func renderCheckout(w http.ResponseWriter, status int, page checkoutPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := checkoutTemplate.Execute(w, page); err != nil {
+		log.Printf("checkout: failed to render page: %v", err)
+	}
+}
+
+var checkoutTemplate = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Checkout (Paddle mock)</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; background: #f4f5f7; color: #1d1d1f; margin: 0; }
+main { max-width: 480px; margin: 40px auto; background: #fff; border-radius: 8px; padding: 24px 32px; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+h1 { font-size: 20px; margin-top: 0; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 16px; }
+td { padding: 4px 0; } td.amount { text-align: right; }
+tr.total td { font-weight: bold; border-top: 1px solid #ddd; padding-top: 8px; }
+label { display: block; font-size: 13px; margin: 12px 0 4px; }
+input { width: 100%; box-sizing: border-box; padding: 8px; font-size: 15px; border: 1px solid #ccc; border-radius: 4px; }
+button { margin-top: 20px; width: 100%; padding: 12px; font-size: 16px; background: #0f62fe; color: #fff; border: 0; border-radius: 4px; cursor: pointer; }
+.error { background: #fde8e8; color: #9b1c1c; padding: 8px 12px; border-radius: 4px; }
+.challenge { border: 1px solid #ddd; border-radius: 6px; padding: 0 16px 16px; } .challenge h2 { font-size: 16px; }
+button.secondary { background: #fff; color: #9b1c1c; border: 1px solid #9b1c1c; margin-top: 8px; }
+.paid { background: #e6f4ea; color: #1e6b33; padding: 8px 12px; border-radius: 4px; }
+details { margin-top: 20px; font-size: 13px; } code { font-size: 12px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Checkout</h1>
+{{if .Error}}<p class="error" id="checkout-error">{{.Error}}</p>{{end}}
+{{with .Transaction}}
+<table>
+{{range $.Lines}}<tr><td>{{.Description}} &times; {{.Quantity}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}<tr><td>Subtotal</td><td class="amount">{{$.Subtotal}}</td></tr>
+{{if $.Discount}}<tr><td>Discount</td><td class="amount" id="checkout-discount">-{{$.Discount}}</td></tr>
+{{end}}<tr><td>Tax</td><td class="amount">{{$.Tax}}</td></tr>
+{{if $.Credit}}<tr><td>Credit</td><td class="amount">-{{$.Credit}}</td></tr>
+{{end}}<tr class="total"><td>Total due</td><td class="amount" id="checkout-total">{{$.Total}}</td></tr>
+</table>
+{{if $.Paid}}
+<p class="paid" id="checkout-completed">Payment complete. Transaction {{.ID}} is {{.Status}}.</p>
+{{else if $.Challenge}}
+<form method="post" action="/checkout" id="checkout-challenge" class="challenge">
+<h2>3-D Secure</h2>
+<p>Your bank needs you to confirm this payment of {{$.Total}}. This is a mock challenge: choose the outcome.</p>
+<input type="hidden" name="_ptxn" value="{{.ID}}">
+<input type="hidden" name="success_url" value="{{$.SuccessURL}}">
+{{if $.Embed}}<input type="hidden" name="embed" value="1">
+{{end}}<input type="hidden" name="card_number" value="{{$.CardNumber}}">
+<input type="hidden" name="card_name" value="{{$.CardName}}">
+<input type="hidden" name="card_expiry" value="{{$.CardExpiry}}">
+<button type="submit" name="challenge" value="pass" id="challenge-pass">Complete authentication</button>
+<button type="submit" name="challenge" value="fail" id="challenge-fail" class="secondary">Fail authentication</button>
+</form>
+{{else}}
+<form method="post" action="/checkout" id="checkout-form">
+<input type="hidden" name="_ptxn" value="{{.ID}}">
+<input type="hidden" name="success_url" value="{{$.SuccessURL}}">
+{{if $.Embed}}<input type="hidden" name="embed" value="1">
+{{end}}
+{{if $.NeedsCustomer}}<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{$.Email}}" required>
+{{end}}{{if $.NeedsAddress}}<label for="country">Country (two-letter code)</label>
+<input id="country" name="country" maxlength="2" value="{{$.Country}}" required>
+{{end}}<label for="card_number">Card number</label>
+<input id="card_number" name="card_number" autocomplete="cc-number" required>
+<label for="card_name">Name on card</label>
+<input id="card_name" name="card_name" autocomplete="cc-name">
+<label for="card_expiry">Expiry (MM/YY)</label>
+<input id="card_expiry" name="card_expiry" autocomplete="cc-exp" required>
+<label for="card_cvc">CVC</label>
+<input id="card_cvc" name="card_cvc" autocomplete="cc-csc">
+<button type="submit" id="checkout-submit">Pay {{$.Total}}</button>
+</form>
+<details><summary>Test cards</summary>
+<table>{{range $.TestCards}}<tr><td><code>{{.Number}}</code></td><td>{{.Outcome}}</td></tr>
+{{end}}</table>
+</details>
+{{end}}
+{{end}}
+</main>
+{{if .Event}}<script>
+window.parent.postMessage({source: "paddle-mock-checkout", name: {{.Event}}, data: {{.EventData}}}, "*");
+</script>
+{{end}}</body>
+</html>
+`))
@@ -7,10 +7,12 @@ import (
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
 )
 
 type CustomersHandler struct {
-	Store *store.Store
+	Store   *store.Store
+	Webhook *webhook.Notifier
 }
 
 func (h *CustomersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +31,17 @@ func (h *CustomersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /v1/customers/{id}/addresses[/{address_id}]
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) > 1 {
+		if parts[1] != "addresses" {
+			respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+			return
+		}
+		h.serveAddresses(w, r, parts[0], parts[2:])
+		return
+	}
+
 	// /v1/customers/{id}
 	id := path
 	switch r.Method {
@@ -85,6 +98,7 @@ func (h *CustomersHandler) create(w http.ResponseWriter, r *http.Request) {
 		customer.CustomData = map[string]string{}
 	}
 	h.Store.SetCustomer(customer)
+	h.Webhook.Fire("customer.created", customer)
 	respond(w, r, http.StatusCreated, customer)
 }
 
@@ -119,5 +133,72 @@ func (h *CustomersHandler) update(w http.ResponseWriter, r *http.Request, id str
 	customer.UpdatedAt = time.Now().UTC()
 
 	h.Store.SetCustomer(customer)
+	h.Webhook.Fire("customer.updated", customer)
 	respond(w, r, http.StatusOK, customer)
 }
+
+func (h *CustomersHandler) serveAddresses(w http.ResponseWriter, r *http.Request, customerID string, rest []string) {
+	if _, ok := h.Store.GetCustomer(customerID); !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Customer not found")
+		return
+	}
+
+	if len(rest) == 0 || rest[0] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			addresses := h.Store.ListAddresses(customerID)
+			respondList(w, r, addresses, len(addresses))
+		case http.MethodPost:
+			h.createAddress(w, r, customerID)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+	address, ok := h.Store.GetAddress(rest[0])
+	if !ok || address.CustomerID != customerID {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Address not found")
+		return
+	}
+	respond(w, r, http.StatusOK, address)
+}
+
+func (h *CustomersHandler) createAddress(w http.ResponseWriter, r *http.Request, customerID string) {
+	var req models.CreateAddressRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if len(req.CountryCode) != 2 {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "country_code must be a two-letter ISO 3166-1 code")
+		return
+	}
+
+	now := time.Now().UTC()
+	address := &models.Address{
+		ID:          store.NextID("add"),
+		CustomerID:  customerID,
+		Description: req.Description,
+		FirstLine:   req.FirstLine,
+		SecondLine:  req.SecondLine,
+		City:        req.City,
+		PostalCode:  req.PostalCode,
+		Region:      req.Region,
+		CountryCode: strings.ToUpper(req.CountryCode),
+		Status:      "active",
+		CustomData:  req.CustomData,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if address.CustomData == nil {
+		address.CustomData = map[string]string{}
+	}
+	h.Store.SetAddress(address)
+	h.Webhook.Fire("address.created", address)
+	respond(w, r, http.StatusCreated, address)
+}
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+type DiscountsHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+}
+
+func (h *DiscountsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/discounts")
+	path = strings.TrimPrefix(path, "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, path)
+	case http.MethodPatch:
+		h.update(w, r, path)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+	}
+}
+
+func (h *DiscountsHandler) list(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	q := r.URL.Query()
+	discounts := make([]*models.Discount, 0)
+	for _, d := range h.Store.ListDiscounts() {
+		d = currentDiscount(h.Store, d, now)
+		if ids := q.Get("id"); ids != "" && !containsString(strings.Split(ids, ","), d.ID) {
+			continue
+		}
+		if codes := q.Get("code"); codes != "" && (d.Code == nil || !containsString(strings.Split(codes, ","), *d.Code)) {
+			continue
+		}
+		if statuses := q.Get("status"); statuses != "" && !containsString(strings.Split(statuses, ","), d.Status) {
+			continue
+		}
+		discounts = append(discounts, d)
+	}
+	respondList(w, r, discounts, len(discounts))
+}
+
+func (h *DiscountsHandler) get(w http.ResponseWriter, r *http.Request, id string) {
+	d, ok := h.Store.GetDiscount(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Discount not found")
+		return
+	}
+	respond(w, r, http.StatusOK, currentDiscount(h.Store, d, time.Now().UTC()))
+}
+
+func (h *DiscountsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateDiscountRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+
+	now := time.Now().UTC()
+	d := &models.Discount{
+		ID:                        store.NextID("dsc"),
+		Status:                    "active",
+		Description:               req.Description,
+		EnabledForCheckout:        req.EnabledForCheckout,
+		Code:                      req.Code,
+		Type:                      req.Type,
+		Amount:                    req.Amount,
+		CurrencyCode:              req.CurrencyCode,
+		Recur:                     req.Recur,
+		MaximumRecurringIntervals: req.MaximumRecurringIntervals,
+		UsageLimit:                req.UsageLimit,
+		RestrictTo:                req.RestrictTo,
+		ExpiresAt:                 req.ExpiresAt,
+		CustomData:                req.CustomData,
+		CreatedAt:                 now,
+		UpdatedAt:                 now,
+	}
+	if d.CustomData == nil {
+		d.CustomData = map[string]string{}
+	}
+	if apiErr := validateDiscount(h.Store, d); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	refreshDiscountStatus(d, now)
+
+	h.Store.SetDiscount(d)
+	h.Webhook.Fire("discount.created", d)
+	respond(w, r, http.StatusCreated, d)
+}
+
+func (h *DiscountsHandler) update(w http.ResponseWriter, r *http.Request, id string) {
+	d, ok := h.Store.GetDiscount(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Discount not found")
+		return
+	}
+
+	var req models.UpdateDiscountRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.Status != "" && req.Status != "active" && req.Status != "archived" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "status can only be set to active or archived")
+		return
+	}
+
+	// apply sets the fields the request changes. They are validated on a copy
+	// first, then applied to the stored discount in one update, so a use
+	// counted in the meantime isn't lost.
+	apply := func(d *models.Discount) {
+		if req.Status != "" {
+			d.Status = req.Status
+		}
+		if req.Description != nil {
+			d.Description = *req.Description
+		}
+		if req.Type != "" {
+			d.Type = req.Type
+		}
+		if req.Amount != "" {
+			d.Amount = req.Amount
+		}
+		if req.CurrencyCode != nil {
+			d.CurrencyCode = req.CurrencyCode
+		}
+		if req.EnabledForCheckout != nil {
+			d.EnabledForCheckout = *req.EnabledForCheckout
+		}
+		if req.Code != nil {
+			d.Code = req.Code
+			if *req.Code == "" {
+				d.Code = nil
+			}
+		}
+		if req.Recur != nil {
+			d.Recur = *req.Recur
+			if !d.Recur {
+				d.MaximumRecurringIntervals = nil
+			}
+		}
+		if req.MaximumRecurringIntervals != nil {
+			d.MaximumRecurringIntervals = req.MaximumRecurringIntervals
+		}
+		if req.UsageLimit != nil {
+			d.UsageLimit = req.UsageLimit
+		}
+		if req.RestrictTo != nil {
+			d.RestrictTo = *req.RestrictTo
+			if len(d.RestrictTo) == 0 {
+				d.RestrictTo = nil
+			}
+		}
+		if req.ExpiresAt != nil {
+			d.ExpiresAt = req.ExpiresAt
+		}
+		if req.CustomData != nil {
+			d.CustomData = req.CustomData
+		}
+	}
+	checked := *d
+	apply(&checked)
+	if apiErr := validateDiscount(h.Store, &checked); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	now := time.Now().UTC()
+	updated, err := h.Store.UpdateDiscount(id, func(d *models.Discount) error {
+		apply(d)
+		// A new expiry date or usage limit can make an expired or used up
+		// discount active again.
+		if d.Status != "archived" {
+			d.Status = "active"
+			refreshDiscountStatus(d, now)
+		}
+		d.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Discount not found")
+		return
+	}
+	h.Webhook.Fire("discount.updated", updated)
+	respond(w, r, http.StatusOK, updated)
+}
+
+// validateDiscount checks the settings of a new or updated discount.
+func validateDiscount(s *store.Store, d *models.Discount) *apiError {
+	if strings.TrimSpace(d.Description) == "" {
+		return validationError("description is required")
+	}
+	switch d.Type {
+	case "percentage":
+		rate, err := money.ParseRate(d.Amount)
+		if err != nil || rate.Sign() <= 0 || rate.Cmp(big.NewRat(100, 1)) > 0 {
+			return validationError("amount must be a percentage greater than 0 and at most 100")
+		}
+		d.CurrencyCode = nil
+	case "flat", "flat_per_seat":
+		if amount, err := money.Parse(d.Amount); err != nil || amount <= 0 {
+			return validationError("amount must be a positive amount in the lowest currency unit")
+		}
+		if d.CurrencyCode == nil || len(*d.CurrencyCode) != 3 {
+			return validationError("currency_code is required for " + d.Type + " discounts")
+		}
+		code := strings.ToUpper(*d.CurrencyCode)
+		d.CurrencyCode = &code
+	default:
+		return validationError("type must be one of flat, flat_per_seat, percentage")
+	}
+
+	if d.Code != nil {
+		code := *d.Code
+		if code == "" || len(code) > 32 || strings.Trim(code, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			return validationError("code must be 1 to 32 letters and numbers")
+		}
+		for _, other := range s.ListDiscounts() {
+			if other.ID != d.ID && other.Code != nil && strings.EqualFold(*other.Code, code) {
+				return validationError("code " + code + " is already used by discount " + other.ID)
+			}
+		}
+	}
+
+	if d.MaximumRecurringIntervals != nil {
+		if !d.Recur {
+			return validationError("maximum_recurring_intervals requires recur")
+		}
+		if *d.MaximumRecurringIntervals < 1 {
+			return validationError("maximum_recurring_intervals must be at least 1")
+		}
+	}
+	if d.UsageLimit != nil && *d.UsageLimit < 1 {
+		return validationError("usage_limit must be at least 1")
+	}
+	for _, id := range d.RestrictTo {
+		_, isPrice := s.GetPrice(id)
+		_, isProduct := s.GetProduct(id)
+		if !isPrice && !isProduct {
+			return validationError("restrict_to must list product or price IDs, not found: " + id)
+		}
+	}
+	return nil
+}
+
+// refreshDiscountStatus moves an active discount to expired or used once its
+// expiry date or usage limit is reached, reporting whether it changed.
+func refreshDiscountStatus(d *models.Discount, now time.Time) bool {
+	if d.Status != "active" {
+		return false
+	}
+	switch {
+	case d.ExpiresAt != nil && !now.Before(*d.ExpiresAt):
+		d.Status = "expired"
+	case d.UsageLimit != nil && d.TimesUsed >= *d.UsageLimit:
+		d.Status = "used"
+	default:
+		return false
+	}
+	return true
+}
+
+// transactionDiscount looks up the discount requested for new items and
+// checks that it can be used. It returns nil if id is nil.
+func transactionDiscount(s *store.Store, id *string, currency string, items []models.TransactionItem, now time.Time) (*models.Discount, *apiError) {
+	if id == nil {
+		return nil, nil
+	}
+	d, ok := s.GetDiscount(*id)
+	if !ok {
+		return nil, validationError("Discount not found: " + *id)
+	}
+	if apiErr := checkDiscount(s, d, currency, items, now); apiErr != nil {
+		return nil, apiErr
+	}
+	return d, nil
+}
+
+// appliedDiscount returns the discount already applied to a transaction, for
+// recalculating it, or nil if there is none.
+func appliedDiscount(s *store.Store, id *string) *models.Discount {
+	if id == nil {
+		return nil
+	}
+	d, _ := s.GetDiscount(*id)
+	return d
+}
+
+// checkDiscount reports why d can't be applied to items billed in currency,
+// if it can't.
+func checkDiscount(s *store.Store, d *models.Discount, currency string, items []models.TransactionItem, now time.Time) *apiError {
+	d = currentDiscount(s, d, now)
+	if apiErr := discountStatusError(d); apiErr != nil {
+		return apiErr
+	}
+	if d.CurrencyCode != nil && *d.CurrencyCode != currency {
+		return discountError("discount_currency_mismatch", "Discount "+d.ID+" is in "+*d.CurrencyCode+", transaction is in "+currency)
+	}
+	for _, item := range items {
+		if discountApplies(d, item.Price) {
+			return nil
+		}
+	}
+	return discountError("discount_not_applicable", "Discount "+d.ID+" doesn't apply to any of the items")
+}
+
+// discountStatusError reports why d can't be used, if its status doesn't
+// allow it.
+func discountStatusError(d *models.Discount) *apiError {
+	switch d.Status {
+	case "expired":
+		return discountError("discount_expired", "Discount "+d.ID+" has expired")
+	case "used":
+		return discountError("discount_usage_limit_exceeded", "Discount "+d.ID+" has reached its usage limit")
+	case "archived":
+		return discountError("discount_not_active", "Discount "+d.ID+" is archived")
+	}
+	return nil
+}
+
+func discountError(code, detail string) *apiError {
+	return &apiError{
+		Status: http.StatusBadRequest,
+		Type:   "request_error",
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// discountApplies reports whether d covers price: every price, unless the
+// discount is restricted to certain products and prices.
+func discountApplies(d *models.Discount, price models.Price) bool {
+	if len(d.RestrictTo) == 0 {
+		return true
+	}
+	return containsString(d.RestrictTo, price.ID) || containsString(d.RestrictTo, price.ProductID)
+}
+
+// redeemDiscount counts a use of discount id, for a completed transaction or
+// a new subscription. The status is checked in the same store update, so
+// concurrent redemptions can't exceed the usage limit.
+func redeemDiscount(s *store.Store, id string, now time.Time) *apiError {
+	_, err := s.UpdateDiscount(id, func(d *models.Discount) error {
+		refreshDiscountStatus(d, now)
+		if apiErr := discountStatusError(d); apiErr != nil {
+			return apiErr
+		}
+		d.TimesUsed++
+		d.UpdatedAt = now
+		refreshDiscountStatus(d, now)
+		return nil
+	})
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	if err != nil {
+		return validationError("Discount not found: " + id)
+	}
+	return nil
+}
+
+// currentDiscount returns d with its status brought up to date, storing the
+// change. Only the status is updated, in the store, so a use counted since d
+// was read isn't lost.
+func currentDiscount(s *store.Store, d *models.Discount, now time.Time) *models.Discount {
+	checked := *d
+	if !refreshDiscountStatus(&checked, now) {
+		return d
+	}
+	updated, err := s.UpdateDiscount(d.ID, func(d *models.Discount) error {
+		refreshDiscountStatus(d, now)
+		return nil
+	})
+	if err != nil {
+		return &checked
+	}
+	return updated
+}
+
+// discountByCode finds the discount customers redeem with code at checkout.
+// Codes are not case sensitive.
+func discountByCode(s *store.Store, code string) (*models.Discount, bool) {
+	for _, d := range s.ListDiscounts() {
+		if d.EnabledForCheckout && d.Code != nil && strings.EqualFold(*d.Code, code) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// newSubscriptionDiscount applies d to sub from startsAt, the start of its
+// first billing period. A discount that doesn't recur applies to that period
+// only; a recurring one for maximum_recurring_intervals periods, or
+// indefinitely.
+func newSubscriptionDiscount(d *models.Discount, sub *models.Subscription, startsAt time.Time) *models.SubscriptionDiscount {
+	discount := &models.SubscriptionDiscount{ID: d.ID, StartsAt: startsAt}
+	intervals := 1
+	if d.Recur {
+		if d.MaximumRecurringIntervals == nil {
+			return discount
+		}
+		intervals = *d.MaximumRecurringIntervals
+	}
+	endsAt := addPeriod(startsAt, sub.BillingCycle.Interval, sub.BillingCycle.Frequency*intervals)
+	discount.EndsAt = &endsAt
+	return discount
+}
+
+// firstBillingDate is when a new subscription is first billed: now, or when
+// its trial ends.
+func firstBillingDate(sub *models.Subscription, now time.Time) time.Time {
+	if sub.Status == "trialing" && sub.NextBilledAt != nil {
+		return *sub.NextBilledAt
+	}
+	return now
+}
+
+// startSubscriptionDiscount restarts the discount of a subscription that was
+// trialing with its first billing period, as the trial may end earlier or
+// later than planned.
+func startSubscriptionDiscount(s *store.Store, sub *models.Subscription) {
+	if sub.Discount == nil || sub.CurrentBillingPeriod == nil {
+		return
+	}
+	if d, ok := s.GetDiscount(sub.Discount.ID); ok {
+		sub.Discount = newSubscriptionDiscount(d, sub, sub.CurrentBillingPeriod.StartsAt)
+	}
+}
+
+// activeSubscriptionDiscount returns the discount of sub for period, the
+// billing period being charged for, or nil if none applies. Archiving or
+// expiring a discount doesn't remove it from subscriptions already using it.
+func activeSubscriptionDiscount(s *store.Store, sub *models.Subscription, period *models.BillingPeriodDates) *models.Discount {
+	if sub.Discount == nil {
+		return nil
+	}
+	if sub.Discount.EndsAt != nil && period != nil && !period.StartsAt.Before(*sub.Discount.EndsAt) {
+		return nil
+	}
+	d, ok := s.GetDiscount(sub.Discount.ID)
+	if !ok {
+		return nil
+	}
+	return d
+}
+
+// lineDiscounts splits discount d across items, whose prorated amounts are
+// given. A flat discount is shared between the eligible items in proportion
+// to their amounts; no item is discounted below zero.
+func lineDiscounts(d *models.Discount, items []models.TransactionItem, amounts []money.Amount) []money.Amount {
+	discounts := make([]money.Amount, len(items))
+	if d == nil {
+		return discounts
+	}
+
+	switch d.Type {
+	case "percentage":
+		percent, _ := money.ParseRate(d.Amount)
+		rate := new(big.Rat).Quo(percent, big.NewRat(100, 1))
+		for i, item := range items {
+			if discountApplies(d, item.Price) {
+				discounts[i] = amounts[i].Scale(rate, money.HalfUp)
+			}
+		}
+	case "flat_per_seat":
+		perSeat := storedAmount(d.Amount)
+		for i, item := range items {
+			if !discountApplies(d, item.Price) {
+				continue
+			}
+			discount, err := perSeat.Mul(int64(item.Quantity))
+			discount = discount.Scale(prorationRate(item), money.Down)
+			if err != nil || discount > amounts[i] {
+				discount = amounts[i]
+			}
+			discounts[i] = discount
+		}
+	case "flat":
+		var eligible money.Amount
+		last := -1
+		for i, item := range items {
+			if discountApplies(d, item.Price) {
+				eligible += amounts[i]
+				last = i
+			}
+		}
+		flat := storedAmount(d.Amount)
+		if flat > eligible {
+			flat = eligible
+		}
+		remaining := flat
+		for i, item := range items {
+			if !discountApplies(d, item.Price) || eligible == 0 {
+				continue
+			}
+			if i == last {
+				discounts[i] = remaining
+				break
+			}
+			discounts[i] = flat.Scale(big.NewRat(int64(amounts[i]), int64(eligible)), money.Down)
+			remaining -= discounts[i]
+		}
+	}
+	return discounts
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
 )
 
 type EventsHandler struct {
@@ -18,8 +22,73 @@ func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
 		return
 	}
-	events := h.Store.ListEvents()
-	respondList(w, r, events, len(events))
+
+	perPage, apiErr := perPageParam(r)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	q := r.URL.Query()
+
+	// Event IDs are sequential, so the cursor works even for an event that
+	// is no longer stored, e.g. after /admin/reset.
+	after := q.Get("after")
+	var afterSeq uint64
+	if after != "" {
+		var ok bool
+		if afterSeq, ok = eventSeq(after); !ok {
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "after must be an event ID")
+			return
+		}
+	}
+	events := make([]*models.Event, 0)
+	for _, e := range h.Store.ListEvents() {
+		if seq, _ := eventSeq(e.EventID); after != "" && seq <= afterSeq {
+			continue
+		}
+		if types := q.Get("event_type"); types != "" && !containsString(strings.Split(types, ","), e.EventType) {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	total := len(events)
+	hasMore := len(events) > perPage
+	if hasMore {
+		events = events[:perPage]
+	}
+	// With no new events the next page is polled with the caller's cursor;
+	// without one there is nothing to continue from.
+	if len(events) > 0 {
+		after = events[len(events)-1].EventID
+	}
+	next := ""
+	if after != "" {
+		next = nextPageURL(r, after)
+	}
+	respondPage(w, r, events, perPage, next, hasMore, total)
+}
+
+// eventSeq returns the sequence number of an event ID such as "evt_00000042".
+func eventSeq(id string) (uint64, bool) {
+	digits, ok := strings.CutPrefix(id, "evt_")
+	if !ok || digits == "" {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(digits, 10, 64)
+	return seq, err == nil
+}
+
+// EventTypesHandler serves GET /v1/event-types, the catalog of events that
+// notification settings can subscribe to.
+type EventTypesHandler struct{}
+
+func (h *EventTypesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+	respondList(w, r, webhook.EventTypes, len(webhook.EventTypes))
 }
 
 type NotificationSettingsHandler struct {
@@ -30,11 +99,25 @@ func (h *NotificationSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 	path := strings.TrimPrefix(r.URL.Path, "/v1/notification-settings")
 	path = strings.TrimPrefix(path, "/")
 
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		h.list(w, r)
-	case http.MethodPost:
-		h.create(w, r)
+		h.get(w, r, path)
+	case http.MethodPatch:
+		h.update(w, r, path)
+	case http.MethodDelete:
+		h.delete(w, r, path)
 	default:
 		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
 	}
@@ -42,19 +125,25 @@ func (h *NotificationSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 
 func (h *NotificationSettingsHandler) list(w http.ResponseWriter, r *http.Request) {
 	settings := h.Store.ListNotificationSettings()
+	sort.Slice(settings, func(i, j int) bool { return settings[i].ID < settings[j].ID })
 	respondList(w, r, settings, len(settings))
 }
 
+func (h *NotificationSettingsHandler) get(w http.ResponseWriter, r *http.Request, id string) {
+	ns, ok := h.Store.GetNotificationSetting(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Notification setting not found")
+		return
+	}
+	respond(w, r, http.StatusOK, ns)
+}
+
 func (h *NotificationSettingsHandler) create(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateNotificationSettingRequest
 	if err := decodeJSON(r, &req); err != nil {
 		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
 		return
 	}
-	if req.Destination == "" {
-		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "destination is required")
-		return
-	}
 
 	now := time.Now().UTC()
 	active := true
@@ -71,15 +160,7 @@ func (h *NotificationSettingsHandler) create(w http.ResponseWriter, r *http.Requ
 	}
 	subscribedEvents := req.SubscribedEvents
 	if subscribedEvents == nil {
-		subscribedEvents = []string{
-			"subscription.created",
-			"subscription.updated",
-			"subscription.activated",
-			"subscription.canceled",
-			"subscription.past_due",
-			"transaction.completed",
-			"transaction.payment_failed",
-		}
+		subscribedEvents = webhook.EventTypeNames()
 	}
 
 	ns := &models.NotificationSetting{
@@ -94,7 +175,77 @@ func (h *NotificationSettingsHandler) create(w http.ResponseWriter, r *http.Requ
 		CreatedAt:              now,
 		UpdatedAt:              now,
 	}
+	if apiErr := validateNotificationSetting(ns); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
 
 	h.Store.SetNotificationSetting(ns)
 	respond(w, r, http.StatusCreated, ns)
 }
+
+func (h *NotificationSettingsHandler) update(w http.ResponseWriter, r *http.Request, id string) {
+	ns, ok := h.Store.GetNotificationSetting(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Notification setting not found")
+		return
+	}
+
+	var req models.UpdateNotificationSettingRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+
+	// Work on a copy so a validation failure leaves the stored setting untouched.
+	updated := *ns
+	if req.Description != nil {
+		updated.Description = *req.Description
+	}
+	if req.Destination != nil {
+		updated.Destination = *req.Destination
+	}
+	if req.SubscribedEvents != nil {
+		updated.SubscribedEvents = req.SubscribedEvents
+	}
+	if req.Active != nil {
+		updated.Active = *req.Active
+	}
+	if req.APIVersion != nil {
+		updated.APIVersion = *req.APIVersion
+	}
+	if req.IncludeSensitiveFields != nil {
+		updated.IncludeSensitiveFields = *req.IncludeSensitiveFields
+	}
+	if apiErr := validateNotificationSetting(&updated); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	updated.UpdatedAt = time.Now().UTC()
+
+	h.Store.SetNotificationSetting(&updated)
+	respond(w, r, http.StatusOK, &updated)
+}
+
+func (h *NotificationSettingsHandler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	if !h.Store.DeleteNotificationSetting(id) {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Notification setting not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateNotificationSetting(ns *models.NotificationSetting) *apiError {
+	if ns.Destination == "" {
+		return validationError("destination is required")
+	}
+	if !webhook.IsAPIVersion(ns.APIVersion) {
+		return validationError(fmt.Sprintf("api_version %d is not supported", ns.APIVersion))
+	}
+	for _, name := range ns.SubscribedEvents {
+		if !webhook.IsSubscribable(name) {
+			return validationError("subscribed_events contains an unknown event type: " + name)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/middleware"
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
@@ -36,6 +37,49 @@ func respondList(w http.ResponseWriter, r *http.Request, data interface{}, total
 	})
 }
 
+// respondPage writes one page of a paginated list. As in Paddle, next is
+// returned even on the last page, so clients can poll it for new entities.
+func respondPage(w http.ResponseWriter, r *http.Request, data interface{}, perPage int, next string, hasMore bool, total int) {
+	writeJSON(w, http.StatusOK, models.PaddleListResponse{
+		Data: data,
+		Meta: models.Meta{
+			RequestID: middleware.GetRequestID(r.Context()),
+		},
+		Pagination: &models.PaginationInfo{
+			PerPage:        perPage,
+			Next:           next,
+			HasMore:        hasMore,
+			EstimatedTotal: total,
+		},
+	})
+}
+
+// perPageParam reads the per_page query parameter of a paginated list,
+// which defaults to 50.
+func perPageParam(r *http.Request) (int, *apiError) {
+	v := r.URL.Query().Get("per_page")
+	if v == "" {
+		return 50, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 200 {
+		return 0, validationError("per_page must be a number from 1 to 200")
+	}
+	return n, nil
+}
+
+// nextPageURL returns the URL of the request with its after cursor moved to
+// after.
+func nextPageURL(r *http.Request, after string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	q := r.URL.Query()
+	q.Set("after", after)
+	return scheme + "://" + r.Host + r.URL.Path + "?" + q.Encode()
+}
+
 func respondError(w http.ResponseWriter, r *http.Request, status int, errType, code, detail string) {
 	writeJSON(w, status, models.ErrorResponse{
 		Error: models.ErrorDetail{
@@ -53,3 +97,29 @@ func decodeJSON(r *http.Request, v interface{}) error {
 	defer r.Body.Close()
 	return json.NewDecoder(r.Body).Decode(v)
 }
+
+// apiError is a Paddle error that can be returned from shared business logic
+// and surfaced by the handler with respondAPIError.
+type apiError struct {
+	Status int
+	Type   string
+	Code   string
+	Detail string
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+func respondAPIError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	respondError(w, r, err.Status, err.Type, err.Code, err.Detail)
+}
+
+func validationError(detail string) *apiError {
+	return &apiError{
+		Status: http.StatusBadRequest,
+		Type:   "request_error",
+		Code:   "validation_error",
+		Detail: detail,
+	}
+}
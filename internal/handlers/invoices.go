@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+	"github.com/vlah-software-house/paddle-api-mock/internal/pdf"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+)
+
+// InvoicesHandler serves generated invoice PDFs at /invoices/{transaction_id}.pdf.
+// These are the links returned by GET /v1/transactions/{id}/invoice and, like
+// Paddle's pre-signed links, they need no API key.
+type InvoicesHandler struct {
+	Store *store.Store
+}
+
+func (h *InvoicesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/invoices/"), ".pdf")
+	txn, ok := h.Store.GetTransaction(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	if apiErr := invoiceAvailable(txn); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	disposition := "attachment"
+	if r.URL.Query().Get("disposition") == "inline" {
+		disposition = "inline"
+	}
+
+	body := renderInvoice(h.Store, txn)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="invoice-%s.pdf"`, disposition, *txn.InvoiceNumber))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// invoiceAvailable reports whether an invoice can be generated for txn. Paddle
+// only issues invoices once a transaction has been billed.
+func invoiceAvailable(txn *models.Transaction) *apiError {
+	if txn.InvoiceNumber == nil || txn.Status == "canceled" {
+		return &apiError{
+			Status: http.StatusBadRequest,
+			Type:   "request_error",
+			Code:   "transaction_invoice_not_available",
+			Detail: "Invoices are only available for billed or completed transactions, transaction is " + txn.Status,
+		}
+	}
+	return nil
+}
+
+// invoiceURL is the link to the generated invoice PDF for a transaction.
+func invoiceURL(baseURL, txnID, disposition string) string {
+	url := strings.TrimSuffix(baseURL, "/") + "/invoices/" + txnID + ".pdf"
+	if disposition == "inline" {
+		url += "?disposition=inline"
+	}
+	return url
+}
+
+// renderInvoice lays out the invoice for txn: header, billing details, one row
+// per line item and the totals.
+func renderInvoice(s *store.Store, txn *models.Transaction) []byte {
+	const (
+		left     = 50.0
+		right    = pdf.PageWidth - 50
+		colQty   = 330.0
+		colUnit  = 440.0
+		lineStep = 16.0
+	)
+
+	doc := pdf.New()
+	page := doc.AddPage()
+	y := pdf.PageHeight - 60
+
+	page.Text(left, y, 22, true, "Invoice")
+	page.TextRight(right, y, 10, false, "Paddle.com Market Ltd (mock)")
+	y -= 30
+
+	billedAt := txn.CreatedAt
+	if txn.BilledAt != nil {
+		billedAt = *txn.BilledAt
+	}
+	for _, row := range [][2]string{
+		{"Invoice number", *txn.InvoiceNumber},
+		{"Invoice date", billedAt.Format("2 January 2006")},
+		{"Transaction", txn.ID},
+		{"Status", txn.Status},
+	} {
+		page.Text(left, y, 10, true, row[0])
+		page.Text(left+110, y, 10, false, row[1])
+		y -= lineStep
+	}
+	y -= lineStep
+
+	page.Text(left, y, 10, true, "Bill to")
+	y -= lineStep
+	for _, line := range invoiceBillTo(s, txn) {
+		page.Text(left, y, 10, false, line)
+		y -= lineStep
+	}
+	y -= lineStep
+
+	header := func() {
+		page.Text(left, y, 10, true, "Description")
+		page.TextRight(colQty, y, 10, true, "Qty")
+		page.TextRight(colUnit, y, 10, true, "Unit price")
+		page.TextRight(right, y, 10, true, "Amount")
+		y -= 6
+		page.Line(left, y, right, y)
+		y -= lineStep
+	}
+	header()
+
+	currency := txn.Details.Totals.CurrencyCode
+	for _, line := range txn.Details.LineItems {
+		if y < 120 {
+			page = doc.AddPage()
+			y = pdf.PageHeight - 60
+			header()
+		}
+		page.Text(left, y, 10, false, invoiceDescription(txn, line))
+		page.TextRight(colQty, y, 10, false, strconv.Itoa(line.Quantity))
+		page.TextRight(colUnit, y, 10, false, displayAmount(line.UnitTotals.Subtotal, currency))
+		page.TextRight(right, y, 10, false, displayAmount(line.Totals.Subtotal, currency))
+		y -= lineStep
+	}
+
+	if y < 140 {
+		page = doc.AddPage()
+		y = pdf.PageHeight - 60
+	}
+	y -= 6
+	page.Line(colQty, y+lineStep-6, right, y+lineStep-6)
+	totals := txn.Details.Totals
+	for _, row := range []struct {
+		label, amount string
+		bold          bool
+	}{
+		{"Subtotal", totals.Subtotal, false},
+		{"Discount", totals.Discount, false},
+		{"Tax", totals.Tax, false},
+		{"Total", totals.Total, false},
+		{"Credit", totals.Credit, false},
+		{"Amount due", totals.GrandTotal, true},
+	} {
+		page.Text(colQty+20, y, 10, row.bold, row.label)
+		page.TextRight(right, y, 10, row.bold, displayAmount(row.amount, currency))
+		y -= lineStep
+	}
+
+	return doc.Bytes()
+}
+
+// invoiceBillTo returns the customer and address lines for the invoice,
+// with any revised details of the transaction.
+func invoiceBillTo(s *store.Store, txn *models.Transaction) []string {
+	var lines []string
+	details := currentBillingDetails(s, txn)
+	if details.CustomerName != nil {
+		lines = append(lines, *details.CustomerName)
+	}
+	if customer, ok := s.GetCustomer(txn.CustomerID); ok {
+		lines = append(lines, customer.Email)
+	}
+	if details.BusinessName != nil && *details.BusinessName != "" {
+		lines = append(lines, *details.BusinessName)
+		if details.BusinessTaxIdentifier != nil && *details.BusinessTaxIdentifier != "" {
+			lines = append(lines, "Tax ID: "+*details.BusinessTaxIdentifier)
+		}
+	}
+	if txn.AddressID != nil {
+		if address, ok := s.GetAddress(*txn.AddressID); ok {
+			for _, part := range []*string{details.AddressFirstLine, details.AddressSecondLine} {
+				if part != nil && *part != "" {
+					lines = append(lines, *part)
+				}
+			}
+			var cityLine []string
+			for _, part := range []*string{address.PostalCode, details.AddressCity, details.AddressRegion} {
+				if part != nil && *part != "" {
+					cityLine = append(cityLine, *part)
+				}
+			}
+			if len(cityLine) > 0 {
+				lines = append(lines, strings.Join(cityLine, " "))
+			}
+			lines = append(lines, address.CountryCode)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "-")
+	}
+	return lines
+}
+
+// invoiceDescription names a line item by its product and price.
+func invoiceDescription(txn *models.Transaction, line models.TransactionLineItem) string {
+	desc := line.PriceID
+	if line.Product != nil {
+		desc = line.Product.Name
+	}
+	for _, item := range txn.Items {
+		if item.PriceID == line.PriceID && item.Price.Name != nil {
+			desc += " (" + *item.Price.Name + ")"
+			break
+		}
+	}
+	return desc
+}
+
+// displayAmount formats an amount in the lowest currency unit for people,
+// e.g. "1500" USD becomes "15.00 USD".
+func displayAmount(amount, currency string) string {
+	return money.Format(storedAmount(amount), currency)
+}
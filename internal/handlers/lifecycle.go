@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+)
+
+// Subscription operations checked by checkSubscriptionAction.
+const (
+	actionUpdate         = "update"
+	actionUpdateItems    = "update_items"
+	actionScheduleChange = "schedule_change"
+	actionResume         = "resume"
+	actionActivate       = "activate"
+	actionCharge         = "charge"
+	actionAdvance        = "advance"
+)
+
+// subscriptionTransitions lists the statuses each subscription status may move to.
+// A status may "move" to itself, e.g. an active subscription renewing.
+var subscriptionTransitions = map[string][]string{
+	"trialing": {"active", "past_due", "paused", "canceled"},
+	"active":   {"active", "past_due", "paused", "canceled"},
+	"past_due": {"active", "canceled"},
+	"paused":   {"active", "canceled"},
+	"canceled": {},
+}
+
+// transactionTransitions lists the statuses each transaction status may move to,
+// following Paddle's draft → ready → billed → paid → completed lifecycle.
+var transactionTransitions = map[string][]string{
+	"draft":     {"ready", "canceled"},
+	"ready":     {"draft", "billed", "paid", "canceled"},
+	"billed":    {"paid", "past_due", "canceled"},
+	"past_due":  {"paid", "canceled"},
+	"paid":      {"completed"},
+	"completed": {},
+	"canceled":  {},
+}
+
+// checkSubscriptionAction reports whether action may be applied to sub in its
+// current state, using the error codes the real Paddle API returns.
+func checkSubscriptionAction(sub *models.Subscription, action string) *apiError {
+	if sub.Status == "canceled" {
+		return errSubscriptionCanceled()
+	}
+
+	switch action {
+	case actionUpdateItems, actionScheduleChange:
+		if sub.ScheduledChange != nil {
+			return &apiError{
+				Status: http.StatusConflict,
+				Type:   "request_error",
+				Code:   "subscription_locked_pending_changes",
+				Detail: "Subscription has a scheduled " + sub.ScheduledChange.Action + " pending; remove it before making changes",
+			}
+		}
+		if action == actionUpdateItems && sub.Status == "past_due" {
+			return &apiError{
+				Status: http.StatusBadRequest,
+				Type:   "request_error",
+				Code:   "subscription_update_when_past_due",
+				Detail: "Subscription is past due, so its items cannot be changed",
+			}
+		}
+	case actionActivate:
+		if sub.Status != "trialing" {
+			return &apiError{
+				Status: http.StatusBadRequest,
+				Type:   "request_error",
+				Code:   "subscription_cannot_activate",
+				Detail: "Only trialing subscriptions can be activated, subscription is " + sub.Status,
+			}
+		}
+	case actionCharge:
+		if sub.Status != "active" && sub.Status != "trialing" {
+			return &apiError{
+				Status: http.StatusBadRequest,
+				Type:   "request_error",
+				Code:   "subscription_not_active",
+				Detail: "One-time charges cannot be created for " + sub.Status + " subscriptions",
+			}
+		}
+	}
+	return nil
+}
+
+// transitionSubscription moves sub to status, updating the timestamps and item
+// statuses that go with it. It returns an error if the transition is not allowed.
+func transitionSubscription(sub *models.Subscription, status string, now time.Time) *apiError {
+	allowed := false
+	for _, s := range subscriptionTransitions[sub.Status] {
+		if s == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		if sub.Status == "canceled" {
+			return errSubscriptionCanceled()
+		}
+		return &apiError{
+			Status: http.StatusConflict,
+			Type:   "request_error",
+			Code:   "subscription_invalid_status_change",
+			Detail: "Subscription cannot move from " + sub.Status + " to " + status,
+		}
+	}
+
+	switch status {
+	case "active":
+		sub.PausedAt = nil
+	case "paused":
+		sub.PausedAt = &now
+		sub.NextBilledAt = nil
+	case "canceled":
+		sub.CanceledAt = &now
+		sub.NextBilledAt = nil
+		sub.ScheduledChange = nil
+	}
+
+	sub.Status = status
+	sub.UpdatedAt = now
+	for i := range sub.Items {
+		sub.Items[i].Status = itemStatus(status)
+		sub.Items[i].UpdatedAt = now
+	}
+	return nil
+}
+
+// startBillingPeriod begins a new billing period for sub at start and points
+// next_billed_at at its end, which is returned.
+func startBillingPeriod(sub *models.Subscription, start time.Time) time.Time {
+	end := addPeriod(start, sub.BillingCycle.Interval, sub.BillingCycle.Frequency)
+	sub.NextBilledAt = &end
+	sub.CurrentBillingPeriod = &models.BillingPeriodDates{
+		StartsAt: start,
+		EndsAt:   end,
+	}
+	for i := range sub.Items {
+		sub.Items[i].NextBilledAt = &end
+	}
+	return end
+}
+
+// nextBillingPeriod returns the billing period after the current one of sub,
+// the one its next renewal is for, or nil if it has no current period.
+func nextBillingPeriod(sub *models.Subscription) *models.BillingPeriodDates {
+	if sub.CurrentBillingPeriod == nil {
+		return nil
+	}
+	start := sub.CurrentBillingPeriod.EndsAt
+	return &models.BillingPeriodDates{
+		StartsAt: start,
+		EndsAt:   addPeriod(start, sub.BillingCycle.Interval, sub.BillingCycle.Frequency),
+	}
+}
+
+func errSubscriptionCanceled() *apiError {
+	return &apiError{
+		Status: http.StatusBadRequest,
+		Type:   "request_error",
+		Code:   "subscription_is_canceled_action_invalid",
+		Detail: "Subscription is canceled, so this action cannot be performed",
+	}
+}
+
+// itemStatus maps a subscription status to the status of its items.
+func itemStatus(status string) string {
+	switch status {
+	case "trialing":
+		return "trialing"
+	case "canceled":
+		return "inactive"
+	}
+	return "active"
+}
+
+// transitionTransaction moves txn to status. Billing a transaction assigns its
+// invoice number. It returns an error if the transition is not allowed.
+func transitionTransaction(txn *models.Transaction, status string, now time.Time) *apiError {
+	allowed := false
+	for _, s := range transactionTransitions[txn.Status] {
+		if s == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return &apiError{
+			Status: http.StatusBadRequest,
+			Type:   "request_error",
+			Code:   "transaction_invalid_status_change",
+			Detail: "Transaction cannot move from " + txn.Status + " to " + status,
+		}
+	}
+
+	switch status {
+	case "billed", "paid":
+		if txn.BilledAt == nil {
+			txn.BilledAt = &now
+		}
+		if txn.InvoiceNumber == nil {
+			invoiceNumber := store.NextInvoiceNumber()
+			txn.InvoiceNumber = &invoiceNumber
+		}
+		setPayoutTotals(txn)
+	}
+
+	txn.Status = status
+	txn.UpdatedAt = now
+	setBalance(txn)
+	return nil
+}
+
+// transactionEditable reports whether the fields of txn may still be changed.
+// Only draft and ready transactions can be edited; from billed onwards Paddle
+// treats them as financial records.
+func transactionEditable(txn *models.Transaction) *apiError {
+	if txn.Status == "draft" || txn.Status == "ready" {
+		return nil
+	}
+	return &apiError{
+		Status: http.StatusBadRequest,
+		Type:   "request_error",
+		Code:   "transaction_immutable",
+		Detail: "Transaction is " + txn.Status + " and can no longer be changed",
+	}
+}
+
+// transactionReadyStatus returns "ready" if txn has everything Paddle needs to
+// bill it (items, a customer and an address), otherwise "draft".
+func transactionReadyStatus(txn *models.Transaction) string {
+	if len(txn.Items) > 0 && txn.CustomerID != "" && txn.AddressID != nil {
+		return "ready"
+	}
+	return "draft"
+}
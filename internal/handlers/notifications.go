@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+// NotificationsHandler serves /v1/notifications, the record of every webhook
+// delivery with its attempts.
+type NotificationsHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+}
+
+func (h *NotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/notifications")
+	path = strings.TrimPrefix(path, "/")
+
+	if path == "" {
+		if r.Method == http.MethodGet {
+			h.list(w, r)
+			return
+		}
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	// Sub-routes: {id}/logs, {id}/replay
+	parts := strings.SplitN(path, "/", 2)
+	ntf, ok := h.Store.GetNotification(parts[0])
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Notification not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		respond(w, r, http.StatusOK, ntf)
+	case len(parts) == 2 && parts[1] == "logs" && r.Method == http.MethodGet:
+		logs := h.Store.ListNotificationLogs(ntf.ID)
+		respondList(w, r, logs, len(logs))
+	case len(parts) == 2 && parts[1] == "replay" && r.Method == http.MethodPost:
+		h.replay(w, r, ntf)
+	default:
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+	}
+}
+
+func (h *NotificationsHandler) list(w http.ResponseWriter, r *http.Request) {
+	perPage, apiErr := perPageParam(r)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	q := r.URL.Query()
+
+	after := q.Get("after")
+	notifications := make([]*models.Notification, 0)
+	for _, ntf := range h.Store.ListNotifications() {
+		if after != "" && ntf.ID <= after {
+			continue
+		}
+		if settings := q.Get("notification_setting_id"); settings != "" && !containsString(strings.Split(settings, ","), ntf.NotificationSettingID) {
+			continue
+		}
+		if statuses := q.Get("status"); statuses != "" && !containsString(strings.Split(statuses, ","), ntf.Status) {
+			continue
+		}
+		notifications = append(notifications, ntf)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+
+	total := len(notifications)
+	hasMore := len(notifications) > perPage
+	if hasMore {
+		notifications = notifications[:perPage]
+	}
+	if len(notifications) > 0 {
+		after = notifications[len(notifications)-1].ID
+	}
+	respondPage(w, r, notifications, perPage, nextPageURL(r, after), hasMore, total)
+}
+
+// replay sends the notification's event again as a new notification with
+// origin "replay".
+func (h *NotificationsHandler) replay(w http.ResponseWriter, r *http.Request, ntf *models.Notification) {
+	ns, ok := h.Store.GetNotificationSetting(ntf.NotificationSettingID)
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Notification setting not found")
+		return
+	}
+	replay := h.Webhook.Replay(ntf, ns)
+	respond(w, r, http.StatusAccepted, map[string]string{"notification_id": replay.ID})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import "net/http"
+
+// PaddleJSHandler serves a stand-in for Paddle.js at /paddle.js. Load it
+// instead of https://cdn.paddle.com/paddle/v2/paddle.js and
+// Paddle.Checkout.open shows the mock's hosted checkout in an overlay.
+type PaddleJSHandler struct{}
+
+func (h *PaddleJSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(paddleJS))
+}
+
+// paddleJS implements the parts of the Paddle.js v2 API that checkouts use:
+// Initialize, Update, Checkout.open/close and eventCallback. The checkout
+// page posts its events to the overlay with window.postMessage.
+const paddleJS = `(function () {
+  "use strict";
+
+  var script = document.currentScript;
+  var origin = script && script.src ? new URL(script.src).origin : window.location.origin;
+  var config = {};
+  var overlay = null;
+  var settings = {};
+  var lastData = null;
+
+  function emit(name, data) {
+    if (typeof config.eventCallback === "function") {
+      config.eventCallback({ name: name, data: data || null });
+    }
+  }
+
+  function close() {
+    if (!overlay) {
+      return;
+    }
+    overlay.parentNode.removeChild(overlay);
+    overlay = null;
+    emit("checkout.closed", lastData);
+    lastData = null;
+  }
+
+  function show(transactionId, options) {
+    var params = new URLSearchParams({ _ptxn: transactionId, embed: "1" });
+    var customer = options.customer || {};
+    if (customer.email) {
+      params.set("email", customer.email);
+    }
+    if (customer.address && customer.address.countryCode) {
+      params.set("country", customer.address.countryCode);
+    }
+
+    overlay = document.createElement("div");
+    overlay.setAttribute("data-paddle-mock-checkout", "");
+    overlay.style.cssText = "position:fixed;inset:0;z-index:2147483647;background:rgba(0,0,0,.5);display:flex;align-items:center;justify-content:center;";
+
+    var frame = document.createElement("iframe");
+    frame.name = "paddle_frame";
+    frame.src = origin + "/checkout?" + params.toString();
+    frame.style.cssText = "width:520px;max-width:100%;height:90%;border:0;border-radius:8px;background:#f4f5f7;";
+
+    var button = document.createElement("button");
+    button.type = "button";
+    button.textContent = "×";
+    button.setAttribute("aria-label", "Close checkout");
+    button.style.cssText = "position:absolute;top:16px;right:24px;font-size:32px;color:#fff;background:none;border:0;cursor:pointer;";
+    button.addEventListener("click", close);
+
+    overlay.appendChild(frame);
+    overlay.appendChild(button);
+    document.body.appendChild(overlay);
+  }
+
+  window.addEventListener("message", function (event) {
+    var message = event.data;
+    if (event.origin !== origin || !message || message.source !== "paddle-mock-checkout") {
+      return;
+    }
+    lastData = message.data;
+    emit(message.name, message.data);
+    if (message.name === "checkout.completed" && settings.successUrl) {
+      window.location.href = settings.successUrl;
+    }
+  });
+
+  function open(options) {
+    options = options || {};
+    if (overlay) {
+      close();
+    }
+    settings = Object.assign({}, config.checkout && config.checkout.settings, options.settings);
+
+    if (options.transactionId) {
+      show(options.transactionId, options);
+      return;
+    }
+    if (!options.items || !options.items.length) {
+      throw new Error("Paddle.Checkout.open requires items or transactionId");
+    }
+
+    var body = {
+      items: options.items.map(function (item) {
+        return { price_id: item.priceId, quantity: item.quantity || 1 };
+      }),
+      custom_data: options.customData,
+      discount_id: options.discountId,
+      discount_code: options.discountCode
+    };
+    fetch(origin + "/checkout/transactions", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body)
+    })
+      .then(function (res) {
+        return res.json().then(function (json) {
+          if (!res.ok) {
+            throw json.error;
+          }
+          return json.data;
+        });
+      })
+      .then(function (txn) {
+        show(txn.id, options);
+      })
+      .catch(function (err) {
+        emit("checkout.error", err);
+      });
+  }
+
+  window.Paddle = {
+    Environment: { set: function () {} },
+    Initialize: function (options) {
+      config = Object.assign({}, options);
+      if (config.checkout && config.checkout.settings) {
+        settings = Object.assign({}, config.checkout.settings);
+      }
+    },
+    Update: function (options) {
+      config = Object.assign({}, config, options);
+    },
+    Checkout: {
+      open: open,
+      close: close
+    }
+  };
+})();
+`
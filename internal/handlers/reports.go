@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+// reportLifetime is how long a report can be downloaded once it is ready.
+const reportLifetime = 7 * 24 * time.Hour
+
+// ReportsHandler serves /v1/reports. A report's CSV is generated from the
+// store when the report is requested. The report stays pending until it is
+// first polled, then it is ready to download.
+type ReportsHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+	// BaseURL is the public URL of the mock, used to build download links.
+	BaseURL string
+}
+
+func (h *ReportsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/reports")
+	path = strings.TrimPrefix(path, "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	// Check for sub-routes: {id}/download-url
+	parts := strings.SplitN(path, "/", 2)
+	id := parts[0]
+
+	if len(parts) == 2 {
+		if parts[1] == "download-url" && r.Method == http.MethodGet {
+			h.downloadURL(w, r, id)
+			return
+		}
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.get(w, r, id)
+		return
+	}
+	respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+}
+
+func (h *ReportsHandler) list(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	reports := make([]*models.Report, 0)
+	for _, rep := range h.Store.ListReports() {
+		rep = h.poll(rep, now)
+		if statuses := r.URL.Query().Get("status"); statuses != "" && !containsString(strings.Split(statuses, ","), rep.Status) {
+			continue
+		}
+		reports = append(reports, rep)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
+	respondList(w, r, reports, len(reports))
+}
+
+func (h *ReportsHandler) get(w http.ResponseWriter, r *http.Request, id string) {
+	rep, ok := h.Store.GetReport(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Report not found")
+		return
+	}
+	rep = h.poll(rep, time.Now().UTC())
+	respond(w, r, http.StatusOK, rep)
+}
+
+func (h *ReportsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateReportRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	columns, ok := reportColumns[req.Type]
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "type must be one of adjustments, discounts, transactions")
+		return
+	}
+	filters, apiErr := parseReportFilters(req.Type, req.Filters)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	rows := make([]reportRow, 0)
+	for _, row := range reportRows(h.Store, req.Type) {
+		if row.matches(filters) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].createdAt.Equal(rows[j].createdAt) {
+			return rows[i].createdAt.Before(rows[j].createdAt)
+		}
+		return rows[i].record[0] < rows[j].record[0]
+	})
+
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.Write(columns)
+	for _, row := range rows {
+		out.Write(row.record)
+	}
+	out.Flush()
+
+	now := time.Now().UTC()
+	if req.Filters == nil {
+		req.Filters = make([]models.ReportFilter, 0)
+	}
+	rep := &models.Report{
+		ID:        store.NextID("rep"),
+		Status:    "pending",
+		Type:      req.Type,
+		Filters:   req.Filters,
+		CreatedAt: now,
+		UpdatedAt: now,
+		CSV:       buf.Bytes(),
+	}
+	h.Store.SetReport(rep)
+	h.Webhook.Fire("report.created", rep)
+
+	respond(w, r, http.StatusCreated, rep)
+}
+
+// poll stands in for Paddle finishing a report in the background: a pending
+// report is ready the first time it is read. Ready reports expire after
+// reportLifetime. It returns the report as it now is; only the call that
+// changed the status fires report.updated.
+func (h *ReportsHandler) poll(rep *models.Report, now time.Time) *models.Report {
+	updated, changed := h.Store.UpdateReport(rep.ID, func(rep *models.Report) bool {
+		switch {
+		case rep.Status == "pending":
+			// The CSV has a header line, then one line per row.
+			records, _ := csv.NewReader(bytes.NewReader(rep.CSV)).ReadAll()
+			rows := len(records) - 1
+			expiresAt := now.Add(reportLifetime)
+			rep.Status = "ready"
+			rep.Rows = &rows
+			rep.ExpiresAt = &expiresAt
+		case rep.Status == "ready" && rep.ExpiresAt != nil && !now.Before(*rep.ExpiresAt):
+			rep.Status = "expired"
+			rep.CSV = nil
+		default:
+			return false
+		}
+		rep.UpdatedAt = now
+		return true
+	})
+	if updated == nil {
+		return rep
+	}
+	if changed {
+		h.Webhook.Fire("report.updated", updated)
+	}
+	return updated
+}
+
+// downloadURL returns the link to a ready report's CSV.
+func (h *ReportsHandler) downloadURL(w http.ResponseWriter, r *http.Request, id string) {
+	rep, ok := h.Store.GetReport(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Report not found")
+		return
+	}
+	rep = h.poll(rep, time.Now().UTC())
+	if rep.Status != "ready" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "report_not_ready", "Report is "+rep.Status+" and can't be downloaded")
+		return
+	}
+	respond(w, r, http.StatusOK, map[string]string{
+		"url": strings.TrimSuffix(h.BaseURL, "/") + "/reports/" + rep.ID + ".csv",
+	})
+}
+
+// ReportFilesHandler serves ready report CSVs at /reports/{report_id}.csv,
+// the links returned by GET /v1/reports/{id}/download-url. Like Paddle's
+// pre-signed links, they need no API key.
+type ReportFilesHandler struct {
+	Store *store.Store
+}
+
+func (h *ReportFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/reports/"), ".csv")
+	rep, ok := h.Store.GetReport(id)
+	if !ok || rep.Status != "ready" || !time.Now().Before(*rep.ExpiresAt) {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Report not found, not ready or expired")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(rep.CSV)))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+rep.Type+`-`+rep.ID+`.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(rep.CSV)
+}
+
+// reportColumns are the CSV columns for each report type. Amounts are in the
+// lowest currency unit, as in the API.
+var reportColumns = map[string][]string{
+	"transactions": {
+		"id", "status", "origin", "collection_mode", "customer_id", "address_id", "business_id",
+		"subscription_id", "discount_id", "invoice_number", "currency_code", "subtotal", "discount",
+		"tax", "total", "credit", "grand_total", "billed_at", "created_at", "updated_at",
+	},
+	"adjustments": {
+		"id", "transaction_id", "subscription_id", "customer_id", "action", "type", "reason", "status",
+		"currency_code", "subtotal", "tax", "total", "credit_applied_to_balance", "created_at", "updated_at",
+	},
+	"discounts": {
+		"id", "status", "description", "type", "amount", "currency_code", "code", "enabled_for_checkout",
+		"recur", "maximum_recurring_intervals", "usage_limit", "times_used", "restrict_to", "expires_at",
+		"created_at", "updated_at",
+	},
+}
+
+// reportFilterNames are the filters each report type accepts, besides
+// updated_at.
+var reportFilterNames = map[string][]string{
+	"transactions": {"collection_mode", "currency_code", "origin", "status"},
+	"adjustments":  {"action", "currency_code", "status"},
+	"discounts":    {"status", "type"},
+}
+
+// reportFilter is a validated models.ReportFilter.
+type reportFilter struct {
+	name     string
+	operator string
+	values   []string
+	at       time.Time // for updated_at
+}
+
+// parseReportFilters validates filters for a report of reportType.
+func parseReportFilters(reportType string, filters []models.ReportFilter) ([]reportFilter, *apiError) {
+	parsed := make([]reportFilter, 0, len(filters))
+	for _, f := range filters {
+		pf := reportFilter{name: f.Name}
+		if f.Operator != nil {
+			pf.operator = *f.Operator
+		}
+
+		if f.Name == "updated_at" {
+			if pf.operator != "lt" && pf.operator != "gte" {
+				return nil, validationError("operator for updated_at must be lt or gte")
+			}
+			value, _ := f.Value.(string)
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, validationError("value for updated_at must be an RFC 3339 date")
+			}
+			pf.at = at
+			parsed = append(parsed, pf)
+			continue
+		}
+
+		if !containsString(reportFilterNames[reportType], f.Name) {
+			return nil, validationError("Unknown filter for " + reportType + " reports: " + f.Name)
+		}
+		if pf.operator != "" {
+			return nil, validationError("operator must be null for " + f.Name)
+		}
+		switch value := f.Value.(type) {
+		case string:
+			pf.values = []string{value}
+		case []interface{}:
+			for _, v := range value {
+				s, ok := v.(string)
+				if !ok {
+					return nil, validationError("value for " + f.Name + " must be a string or a list of strings")
+				}
+				pf.values = append(pf.values, s)
+			}
+		}
+		if len(pf.values) == 0 {
+			return nil, validationError("value for " + f.Name + " must be a string or a list of strings")
+		}
+		parsed = append(parsed, pf)
+	}
+	return parsed, nil
+}
+
+// reportRow is one CSV record, with the values its filters match on.
+type reportRow struct {
+	record    []string
+	fields    map[string]string
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (row reportRow) matches(filters []reportFilter) bool {
+	for _, f := range filters {
+		switch {
+		case f.name != "updated_at":
+			if !containsString(f.values, row.fields[f.name]) {
+				return false
+			}
+		case f.operator == "lt":
+			if !row.updatedAt.Before(f.at) {
+				return false
+			}
+		default:
+			if row.updatedAt.Before(f.at) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reportRows returns a row for every record of reportType in the store.
+func reportRows(s *store.Store, reportType string) []reportRow {
+	rows := make([]reportRow, 0)
+	switch reportType {
+	case "transactions":
+		for _, txn := range s.ListTransactions() {
+			totals := txn.Details.Totals
+			rows = append(rows, reportRow{
+				record: []string{
+					txn.ID, txn.Status, txn.Origin, txn.CollectionMode, txn.CustomerID, csvString(txn.AddressID),
+					csvString(txn.BusinessID), csvString(txn.SubscriptionID), csvString(txn.DiscountID),
+					csvString(txn.InvoiceNumber), txn.CurrencyCode, totals.Subtotal, totals.Discount, totals.Tax,
+					totals.Total, totals.Credit, totals.GrandTotal, csvTime(txn.BilledAt),
+					csvTime(&txn.CreatedAt), csvTime(&txn.UpdatedAt),
+				},
+				fields: map[string]string{
+					"collection_mode": txn.CollectionMode,
+					"currency_code":   txn.CurrencyCode,
+					"origin":          txn.Origin,
+					"status":          txn.Status,
+				},
+				createdAt: txn.CreatedAt,
+				updatedAt: txn.UpdatedAt,
+			})
+		}
+	case "adjustments":
+		for _, adj := range s.ListAdjustments("") {
+			credit := ""
+			if adj.CreditAppliedToBalance != nil {
+				credit = strconv.FormatBool(*adj.CreditAppliedToBalance)
+			}
+			rows = append(rows, reportRow{
+				record: []string{
+					adj.ID, adj.TransactionID, csvString(adj.SubscriptionID), adj.CustomerID, adj.Action, adj.Type,
+					adj.Reason, adj.Status, adj.CurrencyCode, adj.Totals.Subtotal, adj.Totals.Tax, adj.Totals.Total,
+					credit, csvTime(&adj.CreatedAt), csvTime(&adj.UpdatedAt),
+				},
+				fields: map[string]string{
+					"action":        adj.Action,
+					"currency_code": adj.CurrencyCode,
+					"status":        adj.Status,
+				},
+				createdAt: adj.CreatedAt,
+				updatedAt: adj.UpdatedAt,
+			})
+		}
+	case "discounts":
+		now := time.Now().UTC()
+		for _, d := range s.ListDiscounts() {
+			d = currentDiscount(s, d, now)
+			rows = append(rows, reportRow{
+				record: []string{
+					d.ID, d.Status, d.Description, d.Type, d.Amount, csvString(d.CurrencyCode), csvString(d.Code),
+					strconv.FormatBool(d.EnabledForCheckout), strconv.FormatBool(d.Recur), csvInt(d.MaximumRecurringIntervals),
+					csvInt(d.UsageLimit), strconv.Itoa(d.TimesUsed), strings.Join(d.RestrictTo, " "),
+					csvTime(d.ExpiresAt), csvTime(&d.CreatedAt), csvTime(&d.UpdatedAt),
+				},
+				fields: map[string]string{
+					"status": d.Status,
+					"type":   d.Type,
+				},
+				createdAt: d.CreatedAt,
+				updatedAt: d.UpdatedAt,
+			})
+		}
+	}
+	return rows
+}
+
+func csvString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func csvInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,832 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
+)
+
+// simulationScenarios are the simulation types that send a sequence of
+// events rather than a single one.
+var simulationScenarios = []string{"subscription_creation", "subscription_renewal", "subscription_cancellation"}
+
+// simulatedStatuses sets the status of generated single event payloads, so a
+// subscription.canceled payload describes a canceled subscription whatever
+// state the entity it was built from is in.
+var simulatedStatuses = map[string]string{
+	"subscription.activated": "active",
+	"subscription.canceled":  "canceled",
+	"subscription.past_due":  "past_due",
+	"subscription.paused":    "paused",
+	"subscription.resumed":   "active",
+	"subscription.trialing":  "trialing",
+	"transaction.billed":     "billed",
+	"transaction.canceled":   "canceled",
+	"transaction.completed":  "completed",
+	"transaction.paid":       "paid",
+	"transaction.past_due":   "past_due",
+	"transaction.ready":      "ready",
+}
+
+// SimulationsHandler serves /v1/simulations. Runs are sent straight away to
+// the simulation's notification setting, so a run is completed by the time
+// it is returned. Simulated events are not added to /v1/events.
+type SimulationsHandler struct {
+	Store   *store.Store
+	Webhook *webhook.Notifier
+}
+
+func (h *SimulationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/simulations")
+	path = strings.TrimPrefix(path, "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	// Sub-routes: {id}/runs[/{run_id}[/events[/{event_id}[/replay]]]]
+	parts := strings.Split(path, "/")
+	sim, ok := h.Store.GetSimulation(parts[0])
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Simulation not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			respond(w, r, http.StatusOK, sim)
+		case http.MethodPatch:
+			h.update(w, r, sim)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+	if parts[1] != "runs" || len(parts) > 6 {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+		return
+	}
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.listRuns(w, r, sim)
+		case http.MethodPost:
+			h.createRun(w, r, sim)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	run, ok := h.Store.GetSimulationRun(parts[2])
+	if !ok || run.SimulationID != sim.ID {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Simulation run not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		respond(w, r, http.StatusOK, h.runWithEvents(r, run))
+		return
+	case len(parts) == 4 && parts[3] == "events" && r.Method == http.MethodGet:
+		events := h.runEvents(run)
+		respondList(w, r, events, len(events))
+		return
+	case len(parts) < 5 || parts[3] != "events":
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+		return
+	}
+
+	e, ok := h.Store.GetSimulationRunEvent(parts[4])
+	if !ok || e.RunID != run.ID {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Simulation run event not found")
+		return
+	}
+	switch {
+	case len(parts) == 5 && r.Method == http.MethodGet:
+		respond(w, r, http.StatusOK, e)
+	case len(parts) == 6 && parts[5] == "replay" && r.Method == http.MethodPost:
+		h.replayEvent(w, r, sim, e)
+	default:
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
+	}
+}
+
+func (h *SimulationsHandler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	simulations := make([]*models.Simulation, 0)
+	for _, sim := range h.Store.ListSimulations() {
+		if ids := q.Get("id"); ids != "" && !containsString(strings.Split(ids, ","), sim.ID) {
+			continue
+		}
+		if settings := q.Get("notification_setting_id"); settings != "" && !containsString(strings.Split(settings, ","), sim.NotificationSettingID) {
+			continue
+		}
+		if statuses := q.Get("status"); statuses != "" && !containsString(strings.Split(statuses, ","), sim.Status) {
+			continue
+		}
+		simulations = append(simulations, sim)
+	}
+	sort.Slice(simulations, func(i, j int) bool { return simulations[i].ID < simulations[j].ID })
+	respondList(w, r, simulations, len(simulations))
+}
+
+func (h *SimulationsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateSimulationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+
+	now := time.Now().UTC()
+	sim := &models.Simulation{
+		ID:                    store.NextID("ntfsim"),
+		Status:                "active",
+		NotificationSettingID: req.NotificationSettingID,
+		Name:                  req.Name,
+		Type:                  req.Type,
+		Payload:               req.Payload,
+		Config:                req.Config,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+	if apiErr := validateSimulation(h.Store, sim); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	h.Store.SetSimulation(sim)
+	respond(w, r, http.StatusCreated, sim)
+}
+
+func (h *SimulationsHandler) update(w http.ResponseWriter, r *http.Request, sim *models.Simulation) {
+	var req models.UpdateSimulationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.Status != nil && *req.Status != "active" && *req.Status != "archived" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "status must be active or archived")
+		return
+	}
+
+	// Work on a copy so a validation failure leaves the stored simulation untouched.
+	updated := *sim
+	if req.Status != nil {
+		updated.Status = *req.Status
+	}
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.NotificationSettingID != nil {
+		updated.NotificationSettingID = *req.NotificationSettingID
+	}
+	if req.Type != nil && *req.Type != updated.Type {
+		// The payload or config of the old type doesn't apply to the new one.
+		updated.Type = *req.Type
+		updated.Payload = nil
+		updated.Config = nil
+	}
+	if len(req.Payload) > 0 {
+		// null asks for a payload generated from the mock's data again.
+		var payload interface{}
+		if err := json.Unmarshal(req.Payload, &payload); err != nil {
+			respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+			return
+		}
+		updated.Payload = payload
+	}
+	if req.Config != nil {
+		updated.Config = req.Config
+	}
+	if apiErr := validateSimulation(h.Store, &updated); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	updated.UpdatedAt = time.Now().UTC()
+
+	*sim = updated
+	h.Store.SetSimulation(sim)
+	respond(w, r, http.StatusOK, sim)
+}
+
+func (h *SimulationsHandler) listRuns(w http.ResponseWriter, r *http.Request, sim *models.Simulation) {
+	runs := make([]*models.SimulationRun, 0)
+	for _, run := range h.Store.ListSimulationRuns(sim.ID) {
+		if ids := r.URL.Query().Get("id"); ids != "" && !containsString(strings.Split(ids, ","), run.ID) {
+			continue
+		}
+		runs = append(runs, h.runWithEvents(r, run))
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	respondList(w, r, runs, len(runs))
+}
+
+// createRun builds the simulation's events from the current state of the
+// mock and queues them for the destination. The run is returned pending and
+// completed by sendRun.
+func (h *SimulationsHandler) createRun(w http.ResponseWriter, r *http.Request, sim *models.Simulation) {
+	if sim.Status == "archived" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Archived simulations cannot be run")
+		return
+	}
+	ns, ok := h.Store.GetNotificationSetting(sim.NotificationSettingID)
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Notification setting not found")
+		return
+	}
+
+	now := time.Now().UTC()
+	events, apiErr := simulationEvents(h.Store, sim, now)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	run := &models.SimulationRun{
+		ID:           store.NextID("ntfsimrun"),
+		Status:       "pending",
+		Type:         sim.Type,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		SimulationID: sim.ID,
+	}
+
+	// Requests are built before anything is stored, so a run is either sent
+	// in full or not created.
+	runEvents := make([]*models.SimulationRunEvent, 0, len(events))
+	for _, ev := range events {
+		e := &models.SimulationRunEvent{
+			ID:        store.NextID("ntfsimevt"),
+			Status:    "pending",
+			EventType: ev.eventType,
+			Payload:   ev.payload,
+			CreatedAt: now,
+			UpdatedAt: now,
+			RunID:     run.ID,
+		}
+		body, err := h.requestBody(ns, e)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, "api_error", "internal_error", "Could not build webhook for "+e.EventType+": "+err.Error())
+			return
+		}
+		e.Request = &models.SimulationEventRequest{Body: string(body)}
+		runEvents = append(runEvents, e)
+	}
+	h.Store.SetSimulationRun(run)
+	for _, e := range runEvents {
+		h.Store.SetSimulationRunEvent(e)
+	}
+	sim.LastRunAt = &now
+	h.Store.SetSimulation(sim)
+
+	destination := ns.Destination
+	h.Webhook.Queue(destination, func() { h.sendRun(destination, run, runEvents) })
+	respond(w, r, http.StatusCreated, h.runWithEvents(r, run))
+}
+
+// sendRun sends the events of run to destination in order, then marks the
+// run completed. Once an event fails, the rest are aborted. The stored run
+// and events are replaced, not changed, as requests may be reading them.
+func (h *SimulationsHandler) sendRun(destination string, run *models.SimulationRun, events []*models.SimulationRunEvent) {
+	failed := false
+	for _, e := range events {
+		if failed {
+			aborted := *e
+			aborted.Status = "aborted"
+			aborted.UpdatedAt = time.Now().UTC()
+			h.Store.SetSimulationRunEvent(&aborted)
+			continue
+		}
+		failed = h.deliver(destination, e).Status != "success"
+	}
+
+	completed := *run
+	completed.Status = "completed"
+	completed.UpdatedAt = time.Now().UTC()
+	h.Store.SetSimulationRun(&completed)
+}
+
+// replayEvent sends an event of a run again, exactly as it was first sent.
+func (h *SimulationsHandler) replayEvent(w http.ResponseWriter, r *http.Request, sim *models.Simulation, e *models.SimulationRunEvent) {
+	ns, ok := h.Store.GetNotificationSetting(sim.NotificationSettingID)
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Notification setting not found")
+		return
+	}
+	respond(w, r, http.StatusOK, h.deliver(ns.Destination, e))
+}
+
+// requestBody builds the webhook sent to the destination of ns for e.
+func (h *SimulationsHandler) requestBody(ns *models.NotificationSetting, e *models.SimulationRunEvent) ([]byte, error) {
+	event := &models.Event{
+		EventID:    store.NextID("evt"),
+		EventType:  e.EventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       e.Payload,
+	}
+	return h.Webhook.Payload(ns.APIVersion, event, store.NextID("ntf"))
+}
+
+// deliver sends the request of e to destination and stores, and returns, a
+// copy of e with the response. The status is success if the destination
+// accepted the event.
+func (h *SimulationsHandler) deliver(destination string, e *models.SimulationRunEvent) *models.SimulationRunEvent {
+	resp, err := h.Webhook.Send(destination, []byte(e.Request.Body))
+	sent := *e
+	sent.Status = "failed"
+	// No response means the destination couldn't be reached or timed out.
+	sent.Response = nil
+	if resp != nil {
+		sent.Response = &models.SimulationEventResponse{Body: resp.Body, StatusCode: resp.StatusCode}
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			sent.Status = "success"
+		}
+	}
+	sent.UpdatedAt = time.Now().UTC()
+	h.Store.SetSimulationRunEvent(&sent)
+	return &sent
+}
+
+// runWithEvents returns run with its events attached when the request asks
+// for them with ?include=events.
+func (h *SimulationsHandler) runWithEvents(r *http.Request, run *models.SimulationRun) *models.SimulationRun {
+	if !containsString(strings.Split(r.URL.Query().Get("include"), ","), "events") {
+		return run
+	}
+	withEvents := *run
+	withEvents.Events = h.runEvents(run)
+	return &withEvents
+}
+
+func (h *SimulationsHandler) runEvents(run *models.SimulationRun) []*models.SimulationRunEvent {
+	events := h.Store.ListSimulationRunEvents(run.ID)
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events
+}
+
+// validateSimulation checks sim, filling in the default config of scenarios
+// and generating the payload of single event simulations that don't have one.
+func validateSimulation(s *store.Store, sim *models.Simulation) *apiError {
+	if sim.Name == "" {
+		return validationError("name is required")
+	}
+	if _, ok := s.GetNotificationSetting(sim.NotificationSettingID); !ok {
+		return validationError("Notification setting not found")
+	}
+
+	if containsString(simulationScenarios, sim.Type) {
+		if sim.Payload != nil {
+			return validationError("payload can only be set for single event simulations")
+		}
+		return validateSimulationConfig(s, sim)
+	}
+
+	if !webhook.IsEventType(sim.Type) {
+		return validationError("type must be an event type or one of " + strings.Join(simulationScenarios, ", "))
+	}
+	if sim.Config != nil {
+		return validationError("config can only be set for scenario simulations")
+	}
+	if sim.Payload == nil {
+		payload, apiErr := singleEventPayload(s, sim.Type)
+		if apiErr != nil {
+			return apiErr
+		}
+		sim.Payload = payload
+	}
+	return nil
+}
+
+func validateSimulationConfig(s *store.Store, sim *models.Simulation) *apiError {
+	if sim.Config == nil {
+		sim.Config = &models.SimulationConfig{}
+	}
+	cfg := sim.Config
+	for key, set := range map[string]bool{
+		"subscription_creation":     cfg.SubscriptionCreation != nil,
+		"subscription_renewal":      cfg.SubscriptionRenewal != nil,
+		"subscription_cancellation": cfg.SubscriptionCancellation != nil,
+	} {
+		if set && key != sim.Type {
+			return validationError("config." + key + " does not match simulation type " + sim.Type)
+		}
+	}
+
+	switch sim.Type {
+	case "subscription_creation":
+		if cfg.SubscriptionCreation == nil {
+			cfg.SubscriptionCreation = &models.SimulationCreationConfig{}
+		}
+		entities := cfg.SubscriptionCreation.Entities
+		if entities.CustomerID != nil {
+			if _, ok := s.GetCustomer(*entities.CustomerID); !ok {
+				return validationError("Customer not found: " + *entities.CustomerID)
+			}
+		}
+		if entities.AddressID != nil {
+			if _, ok := s.GetAddress(*entities.AddressID); !ok {
+				return validationError("Address not found: " + *entities.AddressID)
+			}
+		}
+		if entities.DiscountID != nil {
+			if _, ok := s.GetDiscount(*entities.DiscountID); !ok {
+				return validationError("Discount not found: " + *entities.DiscountID)
+			}
+		}
+		if entities.TransactionID != nil {
+			if _, ok := s.GetTransaction(*entities.TransactionID); !ok {
+				return validationError("Transaction not found: " + *entities.TransactionID)
+			}
+		}
+	case "subscription_renewal":
+		if cfg.SubscriptionRenewal == nil {
+			cfg.SubscriptionRenewal = &models.SimulationRenewalConfig{}
+		}
+		options := &cfg.SubscriptionRenewal.Options
+		if options.PaymentOutcome == "" {
+			options.PaymentOutcome = "success"
+		}
+		if options.PaymentOutcome != "success" && options.PaymentOutcome != "failed" {
+			return validationError("payment_outcome must be success or failed")
+		}
+		return checkSimulationSubscription(s, cfg.SubscriptionRenewal.Entities.SubscriptionID)
+	case "subscription_cancellation":
+		if cfg.SubscriptionCancellation == nil {
+			cfg.SubscriptionCancellation = &models.SimulationCancellationConfig{}
+		}
+		options := &cfg.SubscriptionCancellation.Options
+		if options.EffectiveFrom == "" {
+			options.EffectiveFrom = "next_billing_period"
+		}
+		if options.EffectiveFrom != "next_billing_period" && options.EffectiveFrom != "immediately" {
+			return validationError("effective_from must be next_billing_period or immediately")
+		}
+		return checkSimulationSubscription(s, cfg.SubscriptionCancellation.Entities.SubscriptionID)
+	}
+	return nil
+}
+
+func checkSimulationSubscription(s *store.Store, id *string) *apiError {
+	if id == nil {
+		return nil
+	}
+	if _, ok := s.GetSubscription(*id); !ok {
+		return validationError("Subscription not found: " + *id)
+	}
+	return nil
+}
+
+// simulatedEvent is an event a simulation run sends.
+type simulatedEvent struct {
+	eventType string
+	payload   interface{}
+}
+
+// simulationEvents returns the events to send for a run of sim. Scenario
+// payloads are built from copies of the mock's entities, so running a
+// simulation never changes them.
+func simulationEvents(s *store.Store, sim *models.Simulation, now time.Time) ([]simulatedEvent, *apiError) {
+	switch sim.Type {
+	case "subscription_creation":
+		return subscriptionCreationEvents(s, sim.Config.SubscriptionCreation.Entities, now)
+	case "subscription_renewal":
+		return subscriptionRenewalEvents(s, sim.Config.SubscriptionRenewal, now)
+	case "subscription_cancellation":
+		return subscriptionCancellationEvents(s, sim.Config.SubscriptionCancellation, now)
+	}
+	return []simulatedEvent{{eventType: sim.Type, payload: sim.Payload}}, nil
+}
+
+// subscriptionCreationEvents simulates a customer signing up at checkout. The
+// items come from the given transaction, or the newest subscription, or else
+// the first recurring price. customer.created and address.created are only
+// sent when no existing customer is given.
+func subscriptionCreationEvents(s *store.Store, entities models.SimulationCreationEntities, now time.Time) ([]simulatedEvent, *apiError) {
+	req := models.CreateSubscriptionRequest{DiscountID: entities.DiscountID}
+	if entities.TransactionID != nil {
+		txn, ok := s.GetTransaction(*entities.TransactionID)
+		if !ok {
+			return nil, validationError("Transaction not found: " + *entities.TransactionID)
+		}
+		req.CustomerID = txn.CustomerID
+		req.AddressID = txn.AddressID
+		req.CurrencyCode = txn.CurrencyCode
+		for _, item := range txn.Items {
+			if item.Price.BillingCycle != nil {
+				req.Items = append(req.Items, models.CreateSubItemReq{PriceID: item.PriceID, Quantity: item.Quantity})
+			}
+		}
+		if len(req.Items) == 0 {
+			return nil, validationError("Transaction has no recurring items: " + txn.ID)
+		}
+	} else if sub, ok := latestEntity(s, "subscription").(*models.Subscription); ok {
+		req.CurrencyCode = sub.CurrencyCode
+		for _, item := range sub.Items {
+			req.Items = append(req.Items, models.CreateSubItemReq{PriceID: item.Price.ID, Quantity: item.Quantity})
+		}
+	} else {
+		prices := s.ListPrices()
+		sort.Slice(prices, func(i, j int) bool { return prices[i].ID < prices[j].ID })
+		for _, price := range prices {
+			if price.BillingCycle != nil && price.Status == "active" {
+				req.Items = append(req.Items, models.CreateSubItemReq{PriceID: price.ID, Quantity: 1})
+				break
+			}
+		}
+		if len(req.Items) == 0 {
+			return nil, validationError("No recurring price exists to simulate a subscription with")
+		}
+	}
+
+	if entities.CustomerID != nil {
+		req.CustomerID = *entities.CustomerID
+	} else if req.CustomerID == "" {
+		customer, ok := latestEntity(s, "customer").(*models.Customer)
+		if !ok {
+			return nil, validationError("No customer exists to simulate a subscription for")
+		}
+		req.CustomerID = customer.ID
+	}
+	customer, ok := s.GetCustomer(req.CustomerID)
+	if !ok {
+		return nil, validationError("Customer not found: " + req.CustomerID)
+	}
+
+	if entities.AddressID != nil {
+		req.AddressID = entities.AddressID
+	} else if req.AddressID == nil {
+		addresses := s.ListAddresses(customer.ID)
+		sort.Slice(addresses, func(i, j int) bool { return addresses[i].ID < addresses[j].ID })
+		if len(addresses) > 0 {
+			req.AddressID = &addresses[0].ID
+		}
+	}
+	var address *models.Address
+	if req.AddressID != nil {
+		address, ok = s.GetAddress(*req.AddressID)
+		if !ok || address.CustomerID != customer.ID {
+			return nil, validationError("Address not found for customer " + customer.ID + ": " + *req.AddressID)
+		}
+	}
+
+	sub, apiErr := newSubscription(s, req, now)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	events := make([]simulatedEvent, 0)
+	if entities.CustomerID == nil {
+		events = append(events, simulatedEvent{"customer.created", simulationPayload(customer)})
+		if address != nil {
+			events = append(events, simulatedEvent{"address.created", simulationPayload(address)})
+		}
+	}
+
+	// The subscription is created once the checkout transaction is paid.
+	txn := subscriptionTransaction(s, sub, sub.CurrentBillingPeriod, "web", "ready", now)
+	txn.SubscriptionID = nil
+	events = append(events,
+		simulatedEvent{"transaction.created", simulationPayload(txn)},
+		simulatedEvent{"transaction.ready", simulationPayload(txn)},
+	)
+	if apiErr := billSimulatedTransaction(txn, "paid", now); apiErr != nil {
+		return nil, apiErr
+	}
+	recordPayment(txn, "", defaultCard(now), now)
+	txn.SubscriptionID = &sub.ID
+	events = append(events, simulatedEvent{"transaction.paid", simulationPayload(txn)})
+	if apiErr := transitionTransaction(txn, "completed", now); apiErr != nil {
+		return nil, apiErr
+	}
+	events = append(events,
+		simulatedEvent{"transaction.completed", simulationPayload(txn)},
+		simulatedEvent{"subscription.created", simulationPayload(sub)},
+	)
+	if sub.Status == "trialing" {
+		events = append(events, simulatedEvent{"subscription.trialing", simulationPayload(sub)})
+	} else {
+		events = append(events, simulatedEvent{"subscription.activated", simulationPayload(sub)})
+	}
+	return events, nil
+}
+
+// simulatedInvoiceNumber is the invoice number of simulated transactions.
+const simulatedInvoiceNumber = "0000-00000"
+
+// billSimulatedTransaction moves a simulated transaction to status, a billed
+// status, giving it simulatedInvoiceNumber so simulations don't use up the
+// sequence of real invoice numbers.
+func billSimulatedTransaction(txn *models.Transaction, status string, now time.Time) *apiError {
+	if txn.InvoiceNumber == nil {
+		invoiceNumber := simulatedInvoiceNumber
+		txn.InvoiceNumber = &invoiceNumber
+	}
+	return transitionTransaction(txn, status, now)
+}
+
+// subscriptionRenewalEvents simulates a subscription being billed for its
+// next period, with the payment either succeeding or failing.
+func subscriptionRenewalEvents(s *store.Store, cfg *models.SimulationRenewalConfig, now time.Time) ([]simulatedEvent, *apiError) {
+	sub, apiErr := simulationSubscription(s, cfg.Entities.SubscriptionID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	txn := subscriptionTransaction(s, sub, nextBillingPeriod(sub), "subscription_recurring", "ready", now)
+	if apiErr := billSimulatedTransaction(txn, "billed", now); apiErr != nil {
+		return nil, apiErr
+	}
+	events := []simulatedEvent{
+		{"transaction.created", simulationPayload(txn)},
+		{"transaction.billed", simulationPayload(txn)},
+	}
+
+	if cfg.Options.PaymentOutcome == "failed" {
+		recordPayment(txn, "declined", defaultCard(now), now)
+		events = append(events, simulatedEvent{"transaction.payment_failed", simulationPayload(txn)})
+		if apiErr := transitionTransaction(txn, "past_due", now); apiErr != nil {
+			return nil, apiErr
+		}
+		events = append(events, simulatedEvent{"transaction.past_due", simulationPayload(txn)})
+		if apiErr := transitionSubscription(sub, "past_due", now); apiErr != nil {
+			return nil, apiErr
+		}
+		return append(events, simulatedEvent{"subscription.past_due", simulationPayload(sub)}), nil
+	}
+
+	if apiErr := transitionTransaction(txn, "paid", now); apiErr != nil {
+		return nil, apiErr
+	}
+	recordPayment(txn, "", defaultCard(now), now)
+	events = append(events, simulatedEvent{"transaction.paid", simulationPayload(txn)})
+
+	prevEnd := now
+	if sub.CurrentBillingPeriod != nil {
+		prevEnd = sub.CurrentBillingPeriod.EndsAt
+	}
+	if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+		return nil, apiErr
+	}
+	startBillingPeriod(sub, prevEnd)
+	if sub.FirstBilledAt == nil {
+		sub.FirstBilledAt = &now
+	}
+	for i := range sub.Items {
+		sub.Items[i].TrialDates = nil
+		sub.Items[i].PreviouslyBilledAt = &prevEnd
+	}
+	events = append(events, simulatedEvent{"subscription.updated", simulationPayload(sub)})
+
+	if apiErr := transitionTransaction(txn, "completed", now); apiErr != nil {
+		return nil, apiErr
+	}
+	return append(events, simulatedEvent{"transaction.completed", simulationPayload(txn)}), nil
+}
+
+// subscriptionCancellationEvents simulates a subscription being canceled,
+// either straight away or by a scheduled change at the end of its billing
+// period.
+func subscriptionCancellationEvents(s *store.Store, cfg *models.SimulationCancellationConfig, now time.Time) ([]simulatedEvent, *apiError) {
+	sub, apiErr := simulationSubscription(s, cfg.Entities.SubscriptionID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	events := make([]simulatedEvent, 0)
+	canceledAt := now
+	if cfg.Options.EffectiveFrom == "next_billing_period" {
+		if sub.NextBilledAt != nil {
+			canceledAt = *sub.NextBilledAt
+		} else if sub.CurrentBillingPeriod != nil {
+			canceledAt = sub.CurrentBillingPeriod.EndsAt
+		}
+		sub.ScheduledChange = &models.ScheduledChange{Action: "cancel", EffectiveAt: canceledAt}
+		sub.UpdatedAt = now
+		events = append(events, simulatedEvent{"subscription.updated", simulationPayload(sub)})
+	}
+	if apiErr := transitionSubscription(sub, "canceled", canceledAt); apiErr != nil {
+		return nil, apiErr
+	}
+	return append(events, simulatedEvent{"subscription.canceled", simulationPayload(sub)}), nil
+}
+
+// simulationSubscription returns a copy of the subscription with the given
+// ID, or of the newest subscription that isn't canceled.
+func simulationSubscription(s *store.Store, id *string) (*models.Subscription, *apiError) {
+	var sub *models.Subscription
+	if id != nil {
+		found, ok := s.GetSubscription(*id)
+		if !ok {
+			return nil, validationError("Subscription not found: " + *id)
+		}
+		if found.Status == "canceled" {
+			return nil, errSubscriptionCanceled()
+		}
+		sub = found
+	} else {
+		for _, candidate := range s.ListSubscriptions() {
+			if candidate.Status == "canceled" {
+				continue
+			}
+			if sub == nil || candidate.CreatedAt.After(sub.CreatedAt) || candidate.CreatedAt.Equal(sub.CreatedAt) && candidate.ID > sub.ID {
+				sub = candidate
+			}
+		}
+		if sub == nil {
+			return nil, validationError("No subscription exists to simulate; create one or set config entities.subscription_id")
+		}
+	}
+
+	var copied models.Subscription
+	b, _ := json.Marshal(sub)
+	json.Unmarshal(b, &copied)
+	return &copied, nil
+}
+
+// singleEventPayload builds the payload of a single event simulation from the
+// newest entity of the event's kind.
+func singleEventPayload(s *store.Store, eventType string) (interface{}, *apiError) {
+	entity, _, _ := strings.Cut(eventType, ".")
+	v := latestEntity(s, entity)
+	if v == nil {
+		return nil, validationError("No " + entity + " exists to build the " + eventType + " payload from; pass a payload")
+	}
+	payload := simulationPayload(v)
+	if status, ok := simulatedStatuses[eventType]; ok {
+		payload["status"] = status
+	}
+	return payload, nil
+}
+
+// latestEntity returns the most recently created entity of a kind, or nil if
+// there are none.
+func latestEntity(s *store.Store, entity string) interface{} {
+	var latest interface{}
+	var latestAt time.Time
+	var latestID string
+	consider := func(id string, createdAt time.Time, v interface{}) {
+		if latest == nil || createdAt.After(latestAt) || createdAt.Equal(latestAt) && id > latestID {
+			latest, latestAt, latestID = v, createdAt, id
+		}
+	}
+
+	switch entity {
+	case "address":
+		for _, c := range s.ListCustomers() {
+			for _, a := range s.ListAddresses(c.ID) {
+				consider(a.ID, a.CreatedAt, a)
+			}
+		}
+	case "adjustment":
+		for _, adj := range s.ListAdjustments("") {
+			consider(adj.ID, adj.CreatedAt, adj)
+		}
+	case "customer":
+		for _, c := range s.ListCustomers() {
+			consider(c.ID, c.CreatedAt, c)
+		}
+	case "discount":
+		for _, d := range s.ListDiscounts() {
+			consider(d.ID, d.CreatedAt, d)
+		}
+	case "report":
+		for _, rep := range s.ListReports() {
+			consider(rep.ID, rep.CreatedAt, rep)
+		}
+	case "subscription":
+		for _, sub := range s.ListSubscriptions() {
+			consider(sub.ID, sub.CreatedAt, sub)
+		}
+	case "transaction":
+		for _, txn := range s.ListTransactions() {
+			consider(txn.ID, txn.CreatedAt, txn)
+		}
+	}
+	return latest
+}
+
+// simulationPayload snapshots v as a JSON object, so later changes to the
+// entity don't show up in payloads already built.
+func simulationPayload(v interface{}) map[string]interface{} {
+	var payload map[string]interface{}
+	b, _ := json.Marshal(v)
+	json.Unmarshal(b, &payload)
+	return payload
+}
@@ -2,18 +2,21 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
 	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
 )
 
 type SubscriptionsHandler struct {
-	Store    *store.Store
-	Webhook  *webhook.Notifier
+	Store   *store.Store
+	Webhook *webhook.Notifier
+	// Strict disables POST /v1/subscriptions, as on real Paddle: subscriptions
+	// are only created by completing a transaction with recurring items.
+	Strict bool
 }
 
 func (h *SubscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +104,11 @@ func (h *SubscriptionsHandler) get(w http.ResponseWriter, r *http.Request, id st
 }
 
 func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
+	if h.Strict {
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Subscriptions cannot be created directly; complete a transaction with recurring items instead")
+		return
+	}
+
 	var req models.CreateSubscriptionRequest
 	if err := decodeJSON(r, &req); err != nil {
 		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
@@ -112,13 +120,39 @@ func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify customer exists
-	if _, ok := h.Store.GetCustomer(req.CustomerID); !ok {
-		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Customer not found")
+	sub, apiErr := newSubscription(h.Store, req, time.Now().UTC())
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
 		return
 	}
 
-	now := time.Now().UTC()
+	if req.DiscountID != nil {
+		if apiErr := redeemDiscount(h.Store, *req.DiscountID, sub.CreatedAt); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+	h.Store.SetSubscription(sub)
+
+	// Create initial transaction
+	h.createTransaction(sub, "subscription_recurring")
+
+	// Fire webhook
+	h.Webhook.Fire("subscription.created", sub)
+
+	respond(w, r, http.StatusCreated, sub)
+}
+
+// newSubscription builds (but does not store) a subscription for req. Its
+// prices share a billing cycle and trial period, checked by
+// checkRecurringPrices, so it is trialing until the trial ends if they have
+// one, and otherwise active and billed straight away.
+func newSubscription(s *store.Store, req models.CreateSubscriptionRequest, now time.Time) (*models.Subscription, *apiError) {
+	// Verify customer exists
+	if _, ok := s.GetCustomer(req.CustomerID); !ok {
+		return nil, validationError("Customer not found")
+	}
+
 	currency := req.CurrencyCode
 	if currency == "" {
 		currency = "USD"
@@ -132,6 +166,7 @@ func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
 		ID:             store.NextID("sub"),
 		Status:         "trialing",
 		CustomerID:     req.CustomerID,
+		AddressID:      req.AddressID,
 		CurrencyCode:   currency,
 		CreatedAt:      now,
 		UpdatedAt:      now,
@@ -144,17 +179,34 @@ func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
 		sub.CustomData = map[string]string{}
 	}
 
+	lines := make([]money.Amount, 0, len(req.Items))
+	prices := make([]models.Price, 0, len(req.Items))
 	for _, item := range req.Items {
-		price, ok := h.Store.GetPrice(item.PriceID)
+		price, ok := s.GetPrice(item.PriceID)
 		if !ok {
-			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Price not found: "+item.PriceID)
-			return
+			return nil, validationError("Price not found: " + item.PriceID)
+		}
+		if price.BillingCycle == nil {
+			return nil, validationError("Price is not recurring: " + item.PriceID)
 		}
+		prices = append(prices, *price)
+	}
+	if apiErr := checkRecurringPrices(prices); apiErr != nil {
+		return nil, apiErr
+	}
+
+	for i, item := range req.Items {
+		price := &prices[i]
 
 		qty := item.Quantity
 		if qty == 0 {
 			qty = 1
 		}
+		line, apiErr := checkQuantity(price, qty)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		lines = append(lines, line)
 
 		subItem := models.SubscriptionItem{
 			Status:    "trialing",
@@ -165,9 +217,7 @@ func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
 			Price:     *price,
 		}
 
-		if price.BillingCycle != nil {
-			sub.BillingCycle = *price.BillingCycle
-		}
+		sub.BillingCycle = *price.BillingCycle
 
 		if price.TrialPeriod != nil {
 			trialEnd := addPeriod(now, price.TrialPeriod.Interval, price.TrialPeriod.Frequency)
@@ -195,22 +245,25 @@ func (h *SubscriptionsHandler) create(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		if prod, ok := h.Store.GetProduct(price.ProductID); ok {
+		if prod, ok := s.GetProduct(price.ProductID); ok {
 			subItem.Product = prod
 		}
 
 		sub.Items = append(sub.Items, subItem)
 	}
+	if apiErr := checkTotal(lines); apiErr != nil {
+		return nil, apiErr
+	}
 
-	h.Store.SetSubscription(sub)
-
-	// Create initial transaction
-	h.createTransaction(sub, "subscription_recurring")
-
-	// Fire webhook
-	h.Webhook.Fire("subscription.created", sub)
+	if req.DiscountID != nil {
+		d, apiErr := transactionDiscount(s, req.DiscountID, currency, subscriptionItems(sub), now)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		sub.Discount = newSubscriptionDiscount(d, sub, firstBillingDate(sub, now))
+	}
 
-	respond(w, r, http.StatusCreated, sub)
+	return sub, nil
 }
 
 func (h *SubscriptionsHandler) update(w http.ResponseWriter, r *http.Request, id string) {
@@ -226,31 +279,101 @@ func (h *SubscriptionsHandler) update(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
+	// Validate every requested change against the subscription state before
+	// mutating anything.
+	actions := []string{actionUpdate}
 	if req.ScheduledChange != nil {
 		switch req.ScheduledChange.Action {
-		case "cancel":
-			effectiveAt := time.Now().UTC()
-			if sub.CurrentBillingPeriod != nil {
-				effectiveAt = sub.CurrentBillingPeriod.EndsAt
-			}
-			sub.ScheduledChange = &models.ScheduledChange{
-				Action:      "cancel",
-				EffectiveAt: effectiveAt,
-			}
-		case "pause":
-			effectiveAt := time.Now().UTC()
+		case "cancel", "pause":
+			actions = append(actions, actionScheduleChange)
+		case "resume":
+			actions = append(actions, actionResume)
+		default:
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "scheduled_change.action must be one of cancel, pause, resume")
+			return
+		}
+	}
+	if len(req.Items) > 0 {
+		actions = append(actions, actionUpdateItems)
+		switch req.ProrationBillingMode {
+		case "", "prorated_immediately", "full_immediately", "full_next_billing_period", "do_not_bill":
+		case "prorated_next_billing_period":
+			// The mock doesn't carry charges over to the next renewal.
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "proration_billing_mode prorated_next_billing_period is not supported")
+			return
+		default:
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Unknown proration_billing_mode: "+req.ProrationBillingMode)
+			return
+		}
+	}
+	for _, action := range actions {
+		if apiErr := checkSubscriptionAction(sub, action); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+
+	// Resolve item changes (price change) up front so an unknown price leaves
+	// the subscription untouched.
+	var newItems []models.SubscriptionItem
+	var lines []money.Amount
+	for _, item := range req.Items {
+		price, ok := h.Store.GetPrice(item.PriceID)
+		if !ok {
+			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Price not found: "+item.PriceID)
+			return
+		}
+		qty := item.Quantity
+		if qty == 0 {
+			qty = 1
+		}
+		line, apiErr := checkQuantity(price, qty)
+		if apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+		lines = append(lines, line)
+		subItem := models.SubscriptionItem{
+			Status:    itemStatus(sub.Status),
+			Quantity:  qty,
+			Recurring: true,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Price:     *price,
+		}
+		if prod, ok := h.Store.GetProduct(price.ProductID); ok {
+			subItem.Product = prod
+		}
+		newItems = append(newItems, subItem)
+	}
+	if apiErr := checkTotal(lines); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	resumed := false
+	if req.ScheduledChange != nil {
+		switch req.ScheduledChange.Action {
+		case "cancel", "pause":
+			effectiveAt := now
 			if sub.CurrentBillingPeriod != nil {
 				effectiveAt = sub.CurrentBillingPeriod.EndsAt
 			}
 			sub.ScheduledChange = &models.ScheduledChange{
-				Action:      "pause",
+				Action:      req.ScheduledChange.Action,
 				EffectiveAt: effectiveAt,
 			}
 		case "resume":
 			sub.ScheduledChange = nil
 			if sub.Status == "paused" {
-				sub.Status = "active"
-				sub.PausedAt = nil
+				if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+					respondAPIError(w, r, apiErr)
+					return
+				}
+				startBillingPeriod(sub, now)
+				resumed = true
 			}
 		}
 	}
@@ -259,39 +382,23 @@ func (h *SubscriptionsHandler) update(w http.ResponseWriter, r *http.Request, id
 		sub.CustomData = req.CustomData
 	}
 
-	// Handle item changes (price change)
-	if len(req.Items) > 0 {
-		now := time.Now().UTC()
-		newItems := make([]models.SubscriptionItem, 0)
-		for _, item := range req.Items {
-			price, ok := h.Store.GetPrice(item.PriceID)
-			if !ok {
-				respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Price not found: "+item.PriceID)
-				return
-			}
-			qty := item.Quantity
-			if qty == 0 {
-				qty = 1
-			}
-			subItem := models.SubscriptionItem{
-				Status:    sub.Status,
-				Quantity:  qty,
-				Recurring: true,
-				CreatedAt: now,
-				UpdatedAt: now,
-				Price:     *price,
-			}
-			if prod, ok := h.Store.GetProduct(price.ProductID); ok {
-				subItem.Product = prod
-			}
-			newItems = append(newItems, subItem)
-		}
+	var prorationTxn *models.Transaction
+	if newItems != nil {
+		oldItems := sub.Items
 		sub.Items = newItems
+		prorationTxn = prorationTransaction(h.Store, sub, oldItems, req.ProrationBillingMode, now)
 	}
 
-	sub.UpdatedAt = time.Now().UTC()
+	sub.UpdatedAt = now
 	h.Store.SetSubscription(sub)
 	h.Webhook.Fire("subscription.updated", sub)
+	if resumed {
+		h.Webhook.Fire("subscription.resumed", sub)
+	}
+	if prorationTxn != nil {
+		h.Store.SetTransaction(prorationTxn)
+		h.Webhook.Fire("transaction.completed", prorationTxn)
+	}
 
 	respond(w, r, http.StatusOK, sub)
 }
@@ -303,29 +410,21 @@ func (h *SubscriptionsHandler) activate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	if sub.Status != "trialing" {
-		respondError(w, r, http.StatusConflict, "request_error", "conflict", "Subscription is not trialing")
+	if apiErr := checkSubscriptionAction(sub, actionActivate); apiErr != nil {
+		respondAPIError(w, r, apiErr)
 		return
 	}
 
 	now := time.Now().UTC()
-	sub.Status = "active"
-	sub.FirstBilledAt = &now
-	sub.UpdatedAt = now
-
-	// Set next billing period
-	nextBill := addPeriod(now, sub.BillingCycle.Interval, sub.BillingCycle.Frequency)
-	sub.NextBilledAt = &nextBill
-	sub.CurrentBillingPeriod = &models.BillingPeriodDates{
-		StartsAt: now,
-		EndsAt:   nextBill,
+	if apiErr := transitionSubscription(sub, "active", now); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
 	}
-
+	sub.FirstBilledAt = &now
+	startBillingPeriod(sub, now)
+	startSubscriptionDiscount(h.Store, sub)
 	for i := range sub.Items {
-		sub.Items[i].Status = "active"
 		sub.Items[i].TrialDates = nil
-		sub.Items[i].NextBilledAt = &nextBill
-		sub.Items[i].UpdatedAt = now
 	}
 
 	h.Store.SetSubscription(sub)
@@ -345,61 +444,51 @@ func (h *SubscriptionsHandler) charge(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
+	if apiErr := checkSubscriptionAction(sub, actionCharge); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
 	var req models.ChargeRequest
 	if err := decodeJSON(r, &req); err != nil {
 		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
 		return
 	}
 
+	reqItems := make([]models.TransactionItemReq, 0, len(req.Items))
+	for _, item := range req.Items {
+		reqItems = append(reqItems, models.TransactionItemReq{PriceID: item.PriceID, Quantity: item.Quantity})
+	}
+	items, _, apiErr := resolveTransactionItems(h.Store, reqItems, sub.CurrencyCode)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
 	now := time.Now().UTC()
+	invoiceNumber := store.NextInvoiceNumber()
 	txn := &models.Transaction{
 		ID:             store.NextID("txn"),
 		Status:         "completed",
 		CustomerID:     sub.CustomerID,
 		SubscriptionID: &sub.ID,
+		AddressID:      sub.AddressID,
+		InvoiceNumber:  &invoiceNumber,
 		CurrencyCode:   sub.CurrencyCode,
 		CollectionMode: sub.CollectionMode,
 		Origin:         "subscription_charge",
-		Items:          make([]models.TransactionItem, 0),
+		BillingPeriod:  copyPeriod(sub.CurrentBillingPeriod),
+		Items:          items,
+		Details:        transactionDetails(items, sub.CurrencyCode, addressCountry(h.Store, sub.AddressID), nil),
+		Payments:       make([]models.TransactionPayment, 0),
 		BilledAt:       &now,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 		CustomData:     map[string]string{},
 	}
 
-	var totalAmount int
-	for _, item := range req.Items {
-		price, ok := h.Store.GetPrice(item.PriceID)
-		if !ok {
-			respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Price not found: "+item.PriceID)
-			return
-		}
-		qty := item.Quantity
-		if qty == 0 {
-			qty = 1
-		}
-		txnItem := models.TransactionItem{
-			PriceID:  price.ID,
-			Quantity: qty,
-			Price:    *price,
-		}
-		if prod, ok := h.Store.GetProduct(price.ProductID); ok {
-			txnItem.Product = prod
-		}
-		txn.Items = append(txn.Items, txnItem)
-		totalAmount += parseAmount(price.UnitPrice.Amount) * qty
-	}
-
-	total := formatAmount(totalAmount)
-	txn.Details = models.TransactionDetails{
-		Totals: models.TransactionTotals{
-			Subtotal:     total,
-			Tax:          "0",
-			Total:        total,
-			GrandTotal:   total,
-			CurrencyCode: sub.CurrencyCode,
-		},
-	}
+	setPayoutTotals(txn)
+	recordPayment(txn, "", defaultCard(now), now)
 
 	h.Store.SetTransaction(txn)
 	h.Webhook.Fire("transaction.completed", txn)
@@ -407,47 +496,36 @@ func (h *SubscriptionsHandler) charge(w http.ResponseWriter, r *http.Request, id
 	respond(w, r, http.StatusCreated, sub)
 }
 
-func (h *SubscriptionsHandler) createTransaction(sub *models.Subscription, origin string) {
-	now := time.Now().UTC()
-	txn := &models.Transaction{
-		ID:             store.NextID("txn"),
-		Status:         "completed",
-		CustomerID:     sub.CustomerID,
-		SubscriptionID: &sub.ID,
-		CurrencyCode:   sub.CurrencyCode,
-		CollectionMode: sub.CollectionMode,
-		Origin:         origin,
-		Items:          make([]models.TransactionItem, 0),
-		BilledAt:       &now,
-		CreatedAt:      now,
-		UpdatedAt:      now,
-		CustomData:     map[string]string{},
-	}
+func (h *SubscriptionsHandler) createTransaction(sub *models.Subscription, origin string) *models.Transaction {
+	txn := subscriptionTransaction(h.Store, sub, sub.CurrentBillingPeriod, origin, "completed", time.Now().UTC())
+	h.Store.SetTransaction(txn)
+	return txn
+}
 
-	var totalAmount int
-	for _, item := range sub.Items {
-		txnItem := models.TransactionItem{
-			PriceID:  item.Price.ID,
-			Quantity: item.Quantity,
-			Price:    item.Price,
-			Product:  item.Product,
+// checkRecurringPrices rejects recurring prices that couldn't be billed
+// together on one subscription: they must share a billing cycle, and either
+// all have the same trial period or none. Prices without a billing cycle are
+// one-off charges, so are not checked.
+func checkRecurringPrices(prices []models.Price) *apiError {
+	var first *models.Price
+	for i := range prices {
+		price := &prices[i]
+		if price.BillingCycle == nil {
+			continue
+		}
+		if first == nil {
+			first = price
+			continue
+		}
+		if *price.BillingCycle != *first.BillingCycle {
+			return validationError("Recurring prices must have the same billing cycle: " + first.ID + " and " + price.ID + " differ")
+		}
+		if (price.TrialPeriod == nil) != (first.TrialPeriod == nil) ||
+			price.TrialPeriod != nil && *price.TrialPeriod != *first.TrialPeriod {
+			return validationError("Recurring prices must have the same trial period: " + first.ID + " and " + price.ID + " differ")
 		}
-		txn.Items = append(txn.Items, txnItem)
-		totalAmount += parseAmount(item.Price.UnitPrice.Amount) * item.Quantity
-	}
-
-	total := formatAmount(totalAmount)
-	txn.Details = models.TransactionDetails{
-		Totals: models.TransactionTotals{
-			Subtotal:     total,
-			Tax:          "0",
-			Total:        total,
-			GrandTotal:   total,
-			CurrencyCode: sub.CurrencyCode,
-		},
 	}
-
-	h.Store.SetTransaction(txn)
+	return nil
 }
 
 func addPeriod(t time.Time, interval string, frequency int) time.Time {
@@ -464,16 +542,3 @@ func addPeriod(t time.Time, interval string, frequency int) time.Time {
 	return t.AddDate(0, frequency, 0) // default to month
 }
 
-func parseAmount(s string) int {
-	var n int
-	for _, c := range s {
-		if c >= '0' && c <= '9' {
-			n = n*10 + int(c-'0')
-		}
-	}
-	return n
-}
-
-func formatAmount(n int) string {
-	return strconv.Itoa(n)
-}
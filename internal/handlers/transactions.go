@@ -3,30 +3,73 @@ package handlers
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
+	"github.com/vlah-software-house/paddle-api-mock/internal/webhook"
 )
 
 type TransactionsHandler struct {
-	Store *store.Store
+	Store   *store.Store
+	Webhook *webhook.Notifier
+	// BaseURL is the public URL of the mock, used to build checkout and invoice links.
+	BaseURL string
 }
 
 func (h *TransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/v1/transactions")
 	path = strings.TrimPrefix(path, "/")
 
-	if r.Method != http.MethodGet {
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+		}
+		return
+	}
+
+	if path == "preview" {
+		if r.Method == http.MethodPost {
+			h.preview(w, r)
+			return
+		}
 		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
 		return
 	}
 
-	if path == "" {
-		h.list(w, r)
+	// Check for sub-routes: {id}/invoice, {id}/revise, {id}/revisions
+	parts := strings.SplitN(path, "/", 2)
+	id := parts[0]
+
+	if len(parts) == 2 {
+		switch {
+		case parts[1] == "invoice" && r.Method == http.MethodGet:
+			h.invoice(w, r, id)
+			return
+		case parts[1] == "revise" && r.Method == http.MethodPost:
+			h.revise(w, r, id)
+			return
+		case parts[1] == "revisions" && r.Method == http.MethodGet:
+			h.revisions(w, r, id)
+			return
+		}
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Route not found")
 		return
 	}
 
-	h.get(w, r, path)
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, path)
+	case http.MethodPatch:
+		h.update(w, r, path)
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, "request_error", "method_not_allowed", "Method not allowed")
+	}
 }
 
 func (h *TransactionsHandler) list(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +97,17 @@ func (h *TransactionsHandler) list(w http.ResponseWriter, r *http.Request) {
 		txns = filtered
 	}
 
+	// Filter by status
+	if status := r.URL.Query().Get("status"); status != "" {
+		filtered := make([]*models.Transaction, 0)
+		for _, t := range txns {
+			if t.Status == status {
+				filtered = append(filtered, t)
+			}
+		}
+		txns = filtered
+	}
+
 	respondList(w, r, txns, len(txns))
 }
 
@@ -65,3 +119,432 @@ func (h *TransactionsHandler) get(w http.ResponseWriter, r *http.Request, id str
 	}
 	respond(w, r, http.StatusOK, txn)
 }
+
+func (h *TransactionsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateTransactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if len(req.Items) == 0 {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "items is required")
+		return
+	}
+	if req.Status != "" && req.Status != "billed" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "status can only be set to billed when creating a transaction")
+		return
+	}
+
+	collectionMode := req.CollectionMode
+	if collectionMode == "" {
+		collectionMode = "automatic"
+	}
+	if apiErr := h.validateParties(req.CustomerID, req.AddressID, collectionMode); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	items, currency, apiErr := resolveTransactionItems(h.Store, req.Items, req.CurrencyCode)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	customData := req.CustomData
+	if customData == nil {
+		customData = map[string]string{}
+	}
+
+	now := time.Now().UTC()
+	discount, apiErr := transactionDiscount(h.Store, req.DiscountID, currency, items, now)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	txn := &models.Transaction{
+		ID:             store.NextID("txn"),
+		CustomerID:     req.CustomerID,
+		AddressID:      req.AddressID,
+		DiscountID:     req.DiscountID,
+		CurrencyCode:   currency,
+		CollectionMode: collectionMode,
+		Origin:         "api",
+		Items:          items,
+		Details:        transactionDetails(items, currency, addressCountry(h.Store, req.AddressID), discount),
+		Payments:       make([]models.TransactionPayment, 0),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		CustomData:     customData,
+	}
+	txn.Status = transactionReadyStatus(txn)
+	txn.Checkout = h.checkout(txn, req.Checkout)
+
+	if req.Status == "billed" {
+		if apiErr := transitionTransaction(txn, "billed", now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+
+	h.Store.SetTransaction(txn)
+	h.Webhook.Fire("transaction.created", txn)
+	if txn.Status != "draft" {
+		h.Webhook.Fire("transaction."+txn.Status, txn)
+	}
+
+	respond(w, r, http.StatusCreated, txn)
+}
+
+func (h *TransactionsHandler) update(w http.ResponseWriter, r *http.Request, id string) {
+	txn, ok := h.Store.GetTransaction(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+
+	var req models.UpdateTransactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.Status != "" && req.Status != "billed" && req.Status != "canceled" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "status can only be set to billed or canceled")
+		return
+	}
+
+	// Billed transactions may still be canceled, but nothing else changes.
+	fieldsChanged := req.CustomerID != nil || req.AddressID != nil || len(req.Items) > 0 || req.DiscountID != nil ||
+		req.CurrencyCode != "" || req.CollectionMode != "" || req.Checkout != nil || req.CustomData != nil
+	if fieldsChanged || req.Status == "billed" {
+		if apiErr := transactionEditable(txn); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+
+	// Work on a copy so a validation failure leaves the stored transaction untouched.
+	updated := *txn
+	if req.CustomerID != nil {
+		updated.CustomerID = *req.CustomerID
+		if req.AddressID == nil {
+			updated.AddressID = nil
+		}
+	}
+	if req.AddressID != nil {
+		updated.AddressID = req.AddressID
+	}
+	if req.CollectionMode != "" {
+		updated.CollectionMode = req.CollectionMode
+	}
+	if fieldsChanged {
+		if apiErr := h.validateParties(updated.CustomerID, updated.AddressID, updated.CollectionMode); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+	if req.CurrencyCode != "" {
+		updated.CurrencyCode = req.CurrencyCode
+	}
+	if len(req.Items) > 0 {
+		items, _, apiErr := resolveTransactionItems(h.Store, req.Items, updated.CurrencyCode)
+		if apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+		updated.Items = items
+	} else if apiErr := checkItemCurrency(updated.Items, updated.CurrencyCode); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	if req.CustomData != nil {
+		updated.CustomData = req.CustomData
+	}
+
+	now := time.Now().UTC()
+
+	// A new discount is checked; one already applied stays on the
+	// transaction. An empty discount_id removes it. The use is counted when
+	// the transaction completes.
+	discount := appliedDiscount(h.Store, updated.DiscountID)
+	if req.DiscountID != nil {
+		updated.DiscountID, discount = nil, nil
+		if *req.DiscountID != "" {
+			d, apiErr := transactionDiscount(h.Store, req.DiscountID, updated.CurrencyCode, updated.Items, now)
+			if apiErr != nil {
+				respondAPIError(w, r, apiErr)
+				return
+			}
+			updated.DiscountID, discount = req.DiscountID, d
+		}
+	}
+
+	prevStatus := updated.Status
+	if fieldsChanged {
+		recalculateDetails(&updated, addressCountry(h.Store, updated.AddressID), discount)
+		updated.Status = transactionReadyStatus(&updated)
+		updated.Checkout = h.checkout(&updated, req.Checkout)
+		updated.UpdatedAt = now
+	}
+	if req.Status != "" {
+		if apiErr := transitionTransaction(&updated, req.Status, now); apiErr != nil {
+			respondAPIError(w, r, apiErr)
+			return
+		}
+	}
+
+	*txn = updated
+	h.Store.SetTransaction(txn)
+	h.Webhook.Fire("transaction.updated", txn)
+	if txn.Status != prevStatus && txn.Status != "draft" {
+		h.Webhook.Fire("transaction."+txn.Status, txn)
+	}
+
+	respond(w, r, http.StatusOK, txn)
+}
+
+// invoice returns a link to the generated invoice PDF for a transaction.
+func (h *TransactionsHandler) invoice(w http.ResponseWriter, r *http.Request, id string) {
+	txn, ok := h.Store.GetTransaction(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	if apiErr := invoiceAvailable(txn); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	respond(w, r, http.StatusOK, map[string]string{
+		"url": invoiceURL(h.BaseURL, txn.ID, r.URL.Query().Get("disposition")),
+	})
+}
+
+// revise corrects the customer name, address lines or business details on a
+// billed or completed transaction, for example to fix an invoice address.
+// Country and postal code can't be revised, as they determine the tax
+// charged. Each revision is recorded and fires transaction.revised.
+func (h *TransactionsHandler) revise(w http.ResponseWriter, r *http.Request, id string) {
+	txn, ok := h.Store.GetTransaction(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	if txn.Status != "billed" && txn.Status != "completed" {
+		respondError(w, r, http.StatusBadRequest, "request_error", "transaction_cannot_be_revised",
+			"Only billed or completed transactions can be revised, transaction is "+txn.Status)
+		return
+	}
+
+	var req models.ReviseTransactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if req.Customer == nil && req.Address == nil && req.Business == nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "At least one of customer, address or business is required")
+		return
+	}
+
+	if req.Address != nil && txn.AddressID == nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "Transaction has no address to revise")
+		return
+	}
+	previous := currentBillingDetails(h.Store, txn)
+	if req.Business != nil && previous.BusinessName == nil && (req.Business.Name == nil || *req.Business.Name == "") {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "business.name is required to add business details")
+		return
+	}
+
+	// Only this transaction is revised: its customer, address and business
+	// may be shared with other transactions and subscriptions.
+	revised := previous
+	if req.Customer != nil && req.Customer.Name != nil {
+		revised.CustomerName = req.Customer.Name
+	}
+	if req.Address != nil {
+		if req.Address.FirstLine != nil {
+			revised.AddressFirstLine = req.Address.FirstLine
+		}
+		if req.Address.SecondLine != nil {
+			revised.AddressSecondLine = req.Address.SecondLine
+		}
+		if req.Address.City != nil {
+			revised.AddressCity = req.Address.City
+		}
+		if req.Address.Region != nil {
+			revised.AddressRegion = req.Address.Region
+		}
+	}
+	if req.Business != nil {
+		if req.Business.Name != nil {
+			revised.BusinessName = req.Business.Name
+		}
+		if req.Business.CompanyNumber != nil {
+			revised.BusinessCompanyNumber = req.Business.CompanyNumber
+		}
+		if req.Business.TaxIdentifier != nil {
+			revised.BusinessTaxIdentifier = req.Business.TaxIdentifier
+		}
+	}
+
+	now := time.Now().UTC()
+	h.Store.AddRevision(&models.TransactionRevision{
+		ID:            store.NextID("txnrev"),
+		TransactionID: txn.ID,
+		Previous:      previous,
+		Revised:       revised,
+		CreatedAt:     now,
+	})
+	txn.RevisedDetails = &revised
+	txn.RevisedAt = &now
+	txn.UpdatedAt = now
+	h.Store.SetTransaction(txn)
+	h.Webhook.Fire("transaction.revised", txn)
+
+	respond(w, r, http.StatusOK, txn)
+}
+
+// revisions lists the recorded revisions of a transaction, oldest first.
+func (h *TransactionsHandler) revisions(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.Store.GetTransaction(id); !ok {
+		respondError(w, r, http.StatusNotFound, "request_error", "not_found", "Transaction not found")
+		return
+	}
+	revisions := h.Store.ListRevisions(id)
+	respondList(w, r, revisions, len(revisions))
+}
+
+// currentBillingDetails returns the billing details of txn: the details it
+// was last revised to, or else those of its customer, address and business.
+func currentBillingDetails(s *store.Store, txn *models.Transaction) models.TransactionBillingDetails {
+	if txn.RevisedDetails != nil {
+		return *txn.RevisedDetails
+	}
+	var details models.TransactionBillingDetails
+	if customer, ok := s.GetCustomer(txn.CustomerID); ok {
+		details.CustomerName = customer.Name
+	}
+	if txn.AddressID != nil {
+		if address, ok := s.GetAddress(*txn.AddressID); ok {
+			details.AddressFirstLine = address.FirstLine
+			details.AddressSecondLine = address.SecondLine
+			details.AddressCity = address.City
+			details.AddressRegion = address.Region
+		}
+	}
+	if txn.BusinessID != nil {
+		if business, ok := s.GetBusiness(*txn.BusinessID); ok {
+			details.BusinessName = &business.Name
+			details.BusinessCompanyNumber = business.CompanyNumber
+			details.BusinessTaxIdentifier = business.TaxIdentifier
+		}
+	}
+	return details
+}
+
+// preview prices a transaction without saving it, using the same calculation
+// as stored transactions.
+func (h *TransactionsHandler) preview(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionPreviewRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, r, http.StatusBadRequest, "request_error", "bad_request", "Invalid JSON body")
+		return
+	}
+	if len(req.Items) == 0 {
+		respondError(w, r, http.StatusBadRequest, "request_error", "validation_error", "items is required")
+		return
+	}
+
+	customerID := ""
+	if req.CustomerID != nil {
+		customerID = *req.CustomerID
+	}
+	if apiErr := h.validateParties(customerID, req.AddressID, "automatic"); apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	// Items are checked as on create, so a preview is only priced if the
+	// transaction could be created.
+	items, currency, apiErr := resolveTransactionItems(h.Store, req.Items, req.CurrencyCode)
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+	discount, apiErr := transactionDiscount(h.Store, req.DiscountID, currency, items, time.Now().UTC())
+	if apiErr != nil {
+		respondAPIError(w, r, apiErr)
+		return
+	}
+
+	// Tax follows the saved address, or an ad hoc country for anonymous carts.
+	country := addressCountry(h.Store, req.AddressID)
+	if country == "" && req.Address != nil {
+		country = strings.ToUpper(req.Address.CountryCode)
+	}
+
+	details := transactionDetails(items, currency, country, discount)
+	// Nothing is saved, so previewed line items have no IDs.
+	for i := range details.LineItems {
+		details.LineItems[i].ID = ""
+	}
+
+	respond(w, r, http.StatusOK, &models.TransactionPreview{
+		CustomerID:              req.CustomerID,
+		AddressID:               req.AddressID,
+		Address:                 req.Address,
+		CurrencyCode:            currency,
+		DiscountID:              req.DiscountID,
+		Items:                   items,
+		Details:                 details,
+		AvailablePaymentMethods: []string{"card", "paypal", "apple_pay", "google_pay"},
+	})
+}
+
+// validateParties checks that the customer and address exist and belong
+// together. Manually collected transactions must have both.
+func (h *TransactionsHandler) validateParties(customerID string, addressID *string, collectionMode string) *apiError {
+	if collectionMode != "automatic" && collectionMode != "manual" {
+		return validationError("collection_mode must be automatic or manual")
+	}
+	if collectionMode == "manual" && (customerID == "" || addressID == nil) {
+		return validationError("customer_id and address_id are required for manually collected transactions")
+	}
+	if customerID != "" {
+		if _, ok := h.Store.GetCustomer(customerID); !ok {
+			return validationError("Customer not found: " + customerID)
+		}
+	}
+	if addressID != nil {
+		if customerID == "" {
+			return validationError("address_id requires customer_id")
+		}
+		address, ok := h.Store.GetAddress(*addressID)
+		if !ok || address.CustomerID != customerID {
+			return validationError("Address not found for customer: " + *addressID)
+		}
+	}
+	return nil
+}
+
+// checkout returns the checkout details for txn. Automatically collected
+// transactions are paid at checkout, so they get a link to the mock's own
+// checkout unless the request supplies one.
+func (h *TransactionsHandler) checkout(txn *models.Transaction, req *models.TransactionCheckout) *models.TransactionCheckout {
+	if txn.CollectionMode != "automatic" {
+		return nil
+	}
+	if req != nil && req.URL != nil {
+		return &models.TransactionCheckout{URL: req.URL}
+	}
+	if txn.Checkout != nil {
+		return txn.Checkout
+	}
+	url := checkoutURL(h.BaseURL, txn.ID)
+	return &models.TransactionCheckout{URL: &url}
+}
+
+// checkoutURL is the link to the hosted checkout for a transaction, in the
+// same ?_ptxn= form Paddle uses for its default payment link.
+func checkoutURL(baseURL, txnID string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/checkout?_ptxn=" + txnID
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+)
 
 // PaddleResponse is the standard envelope for all Paddle API responses.
 type PaddleResponse struct {
@@ -119,6 +123,46 @@ type UpdateCustomerRequest struct {
 	CustomData map[string]string `json:"custom_data,omitempty"`
 }
 
+// Address represents a Paddle customer address.
+type Address struct {
+	ID          string            `json:"id"`
+	CustomerID  string            `json:"customer_id"`
+	Description *string           `json:"description"`
+	FirstLine   *string           `json:"first_line"`
+	SecondLine  *string           `json:"second_line"`
+	City        *string           `json:"city"`
+	PostalCode  *string           `json:"postal_code"`
+	Region      *string           `json:"region"`
+	CountryCode string            `json:"country_code"`
+	Status      string            `json:"status"`
+	CustomData  map[string]string `json:"custom_data"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Business holds the company details a customer buys as, shown on invoices.
+type Business struct {
+	ID            string    `json:"id"`
+	CustomerID    string    `json:"customer_id"`
+	Name          string    `json:"name"`
+	CompanyNumber *string   `json:"company_number"`
+	TaxIdentifier *string   `json:"tax_identifier"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type CreateAddressRequest struct {
+	Description *string           `json:"description,omitempty"`
+	FirstLine   *string           `json:"first_line,omitempty"`
+	SecondLine  *string           `json:"second_line,omitempty"`
+	City        *string           `json:"city,omitempty"`
+	PostalCode  *string           `json:"postal_code,omitempty"`
+	Region      *string           `json:"region,omitempty"`
+	CountryCode string            `json:"country_code"`
+	CustomData  map[string]string `json:"custom_data,omitempty"`
+}
+
 // Subscription represents a Paddle subscription.
 type Subscription struct {
 	ID                    string              `json:"id"`
@@ -142,7 +186,15 @@ type Subscription struct {
 	Items                 []SubscriptionItem  `json:"items"`
 	CustomData            map[string]string   `json:"custom_data"`
 	ManagementURLs        *ManagementURLs     `json:"management_urls"`
-	Discount              *interface{}        `json:"discount"`
+	Discount              *SubscriptionDiscount `json:"discount"`
+}
+
+// SubscriptionDiscount is the discount applied to a subscription's
+// transactions from StartsAt until EndsAt, or indefinitely if EndsAt is nil.
+type SubscriptionDiscount struct {
+	ID       string     `json:"id"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
 }
 
 type BillingDetails struct {
@@ -182,9 +234,11 @@ type ManagementURLs struct {
 
 type CreateSubscriptionRequest struct {
 	CustomerID     string              `json:"customer_id"`
+	AddressID      *string             `json:"address_id,omitempty"`
 	Items          []CreateSubItemReq  `json:"items"`
 	CurrencyCode   string              `json:"currency_code,omitempty"`
 	CollectionMode string              `json:"collection_mode,omitempty"`
+	DiscountID     *string             `json:"discount_id,omitempty"`
 	CustomData     map[string]string   `json:"custom_data,omitempty"`
 }
 
@@ -219,39 +273,207 @@ type ChargeItem struct {
 // Transaction represents a Paddle transaction.
 type Transaction struct {
 	ID             string            `json:"id"`
-	Status         string            `json:"status"` // "completed", "failed", "past_due"
+	Status         string            `json:"status"` // "draft", "ready", "billed", "paid", "completed", "canceled", "past_due"
 	CustomerID     string            `json:"customer_id"`
 	SubscriptionID *string           `json:"subscription_id"`
+	AddressID      *string           `json:"address_id"`
+	BusinessID     *string           `json:"business_id"`
+	DiscountID     *string           `json:"discount_id"`
 	CurrencyCode   string            `json:"currency_code"`
 	CollectionMode string            `json:"collection_mode"`
-	Origin         string            `json:"origin"` // "subscription_recurring", "subscription_charge", "api"
+	Origin         string            `json:"origin"` // "subscription_recurring", "subscription_charge", "api", "web"
+	InvoiceNumber  *string           `json:"invoice_number"`
+	BillingPeriod  *BillingPeriodDates `json:"billing_period"` // the subscription period billed, if any
 	Items          []TransactionItem `json:"items"`
 	Details        TransactionDetails `json:"details"`
+	Payments       []TransactionPayment `json:"payments"`
+	Checkout       *TransactionCheckout `json:"checkout"`
 	BilledAt       *time.Time        `json:"billed_at"`
+	RevisedAt      *time.Time        `json:"revised_at"`
 	CreatedAt      time.Time         `json:"created_at"`
 	UpdatedAt      time.Time         `json:"updated_at"`
 	CustomData     map[string]string `json:"custom_data"`
+
+	// RevisedDetails are the billing details the transaction was revised
+	// to. They replace those of its customer, address and business on the
+	// invoice; revising never changes those shared records.
+	RevisedDetails *TransactionBillingDetails `json:"-"`
 }
 
-type TransactionItem struct {
+// TransactionPayment is one attempt to collect payment for a transaction.
+type TransactionPayment struct {
+	PaymentAttemptID      string               `json:"payment_attempt_id"`
+	StoredPaymentMethodID string               `json:"stored_payment_method_id"`
+	Amount                string               `json:"amount"`
+	Status                string               `json:"status"` // "captured", "error", "action_required", ...
+	ErrorCode             *string              `json:"error_code"`
+	MethodDetails         PaymentMethodDetails `json:"method_details"`
+	CreatedAt             time.Time            `json:"created_at"`
+	CapturedAt            *time.Time           `json:"captured_at"`
+}
+
+type PaymentMethodDetails struct {
+	Type string       `json:"type"` // "card", "paypal", ...
+	Card *PaymentCard `json:"card"`
+}
+
+type PaymentCard struct {
+	Type           string `json:"type"` // "visa", "mastercard", ...
+	Last4          string `json:"last4"`
+	ExpiryMonth    int    `json:"expiry_month"`
+	ExpiryYear     int    `json:"expiry_year"`
+	CardholderName string `json:"cardholder_name"`
+}
+
+type TransactionCheckout struct {
+	URL *string `json:"url"`
+}
+
+type CreateTransactionRequest struct {
+	Status         string               `json:"status,omitempty"` // "billed" to issue immediately
+	CustomerID     string               `json:"customer_id"`
+	AddressID      *string              `json:"address_id,omitempty"`
+	Items          []TransactionItemReq `json:"items"`
+	CurrencyCode   string               `json:"currency_code,omitempty"`
+	CollectionMode string               `json:"collection_mode,omitempty"`
+	DiscountID     *string              `json:"discount_id,omitempty"`
+	Checkout       *TransactionCheckout `json:"checkout,omitempty"`
+	CustomData     map[string]string    `json:"custom_data,omitempty"`
+}
+
+type UpdateTransactionRequest struct {
+	Status         string               `json:"status,omitempty"` // "billed" or "canceled"
+	CustomerID     *string              `json:"customer_id,omitempty"`
+	AddressID      *string              `json:"address_id,omitempty"`
+	Items          []TransactionItemReq `json:"items,omitempty"`
+	CurrencyCode   string               `json:"currency_code,omitempty"`
+	CollectionMode string               `json:"collection_mode,omitempty"`
+	DiscountID     *string              `json:"discount_id,omitempty"`
+	Checkout       *TransactionCheckout `json:"checkout,omitempty"`
+	CustomData     map[string]string    `json:"custom_data,omitempty"`
+}
+
+type TransactionItemReq struct {
 	PriceID  string `json:"price_id"`
 	Quantity int    `json:"quantity"`
-	Price    Price  `json:"price"`
-	Product  *Product `json:"product,omitempty"`
+}
+
+type TransactionItem struct {
+	PriceID   string     `json:"price_id"`
+	Quantity  int        `json:"quantity"`
+	Proration *Proration `json:"proration"`
+	Price     Price      `json:"price"`
+	Product   *Product   `json:"product,omitempty"`
+	// Trial items start or are in a trial, so are billed at zero.
+	Trial     bool       `json:"-"`
+}
+
+// Proration describes the part of a billing period an item is charged for.
+type Proration struct {
+	Rate          string             `json:"rate"` // e.g. "0.5" for half a period
+	BillingPeriod BillingPeriodDates `json:"billing_period"`
+	// RatRate is Rate exactly, as prorated amounts are worked out from it.
+	RatRate       *big.Rat           `json:"-"`
 }
 
 type TransactionDetails struct {
-	Totals TransactionTotals `json:"totals"`
+	TaxRatesUsed   []TaxRateUsed         `json:"tax_rates_used"`
+	Totals         TransactionTotals     `json:"totals"`
+	AdjustedTotals AdjustedTotals        `json:"adjusted_totals"`
+	PayoutTotals   *PayoutTotals         `json:"payout_totals"`
+	LineItems      []TransactionLineItem `json:"line_items"`
+}
+
+// PayoutTotals are the totals of a billed transaction in the seller's balance
+// currency, with Paddle's fee and the seller's earnings.
+type PayoutTotals struct {
+	Subtotal     string `json:"subtotal"`
+	Discount     string `json:"discount"`
+	Tax          string `json:"tax"`
+	Total        string `json:"total"`
+	Credit       string `json:"credit"`
+	GrandTotal   string `json:"grand_total"`
+	Fee          string `json:"fee"`
+	Earnings     string `json:"earnings"`
+	ExchangeRate string `json:"exchange_rate"`
+	CurrencyCode string `json:"currency_code"`
 }
 
 type TransactionTotals struct {
-	Subtotal    string `json:"subtotal"`
-	Tax         string `json:"tax"`
-	Total       string `json:"total"`
-	GrandTotal  string `json:"grand_total"`
+	Subtotal        string  `json:"subtotal"`
+	Discount        string  `json:"discount"`
+	Tax             string  `json:"tax"`
+	Total           string  `json:"total"`
+	Credit          string  `json:"credit"`
+	CreditToBalance string  `json:"credit_to_balance"`
+	Balance         string  `json:"balance"` // what is left to pay
+	GrandTotal      string  `json:"grand_total"`
+	Fee             *string `json:"fee"`      // null unless paid out in this currency
+	Earnings        *string `json:"earnings"` // null unless paid out in this currency
+	CurrencyCode    string  `json:"currency_code"`
+}
+
+// AdjustedTotals are the transaction totals after refunds and credits.
+type AdjustedTotals struct {
+	Subtotal     string `json:"subtotal"`
+	Tax          string `json:"tax"`
+	Total        string `json:"total"`
+	GrandTotal   string `json:"grand_total"`
 	CurrencyCode string `json:"currency_code"`
 }
 
+// TaxRateUsed summarizes the line items charged at one tax rate.
+type TaxRateUsed struct {
+	TaxRate string         `json:"tax_rate"`
+	Totals  LineItemTotals `json:"totals"`
+}
+
+// TransactionLineItem is the calculated breakdown for one transaction item.
+type TransactionLineItem struct {
+	ID         string         `json:"id,omitempty"`
+	PriceID    string         `json:"price_id"`
+	Quantity   int            `json:"quantity"`
+	Proration  *Proration     `json:"proration"`
+	TaxRate    string         `json:"tax_rate"`
+	UnitTotals LineItemTotals `json:"unit_totals"`
+	Totals     LineItemTotals `json:"totals"`
+	Product    *Product       `json:"product"`
+}
+
+type LineItemTotals struct {
+	Subtotal string `json:"subtotal"`
+	Discount string `json:"discount"`
+	Tax      string `json:"tax"`
+	Total    string `json:"total"`
+}
+
+type TransactionPreviewRequest struct {
+	CustomerID   *string              `json:"customer_id,omitempty"`
+	AddressID    *string              `json:"address_id,omitempty"`
+	Address      *AddressPreview      `json:"address,omitempty"`
+	CurrencyCode string               `json:"currency_code,omitempty"`
+	DiscountID   *string              `json:"discount_id,omitempty"`
+	Items        []TransactionItemReq `json:"items"`
+}
+
+// AddressPreview is an unsaved location used to calculate tax in previews.
+type AddressPreview struct {
+	CountryCode string  `json:"country_code"`
+	PostalCode  *string `json:"postal_code,omitempty"`
+}
+
+// TransactionPreview is a calculated transaction that has not been saved.
+type TransactionPreview struct {
+	CustomerID              *string            `json:"customer_id"`
+	AddressID               *string            `json:"address_id"`
+	Address                 *AddressPreview    `json:"address"`
+	CurrencyCode            string             `json:"currency_code"`
+	DiscountID              *string            `json:"discount_id"`
+	Items                   []TransactionItem  `json:"items"`
+	Details                 TransactionDetails `json:"details"`
+	AvailablePaymentMethods []string           `json:"available_payment_methods"`
+}
+
 // Event represents a fired webhook event.
 type Event struct {
 	EventID    string      `json:"event_id"`
@@ -260,6 +482,42 @@ type Event struct {
 	Data       interface{} `json:"data"`
 }
 
+// Notification is the delivery of an event to one notification setting.
+type Notification struct {
+	ID                    string          `json:"id"`
+	Type                  string          `json:"type"`
+	Status                string          `json:"status"` // "not_attempted", "needs_retry", "delivered", "failed"
+	Payload               json.RawMessage `json:"payload"` // the event as sent
+	OccurredAt            time.Time       `json:"occurred_at"`
+	DeliveredAt           *time.Time      `json:"delivered_at"`
+	ReplayedAt            *time.Time      `json:"replayed_at"`
+	Origin                string          `json:"origin"` // "event", "replay"
+	LastAttemptAt         *time.Time      `json:"last_attempt_at"`
+	RetryAt               *time.Time      `json:"retry_at"`
+	TimesAttempted        int             `json:"times_attempted"`
+	NotificationSettingID string          `json:"notification_setting_id"`
+}
+
+// NotificationLog records one attempt to deliver a notification.
+type NotificationLog struct {
+	ID                  string    `json:"id"`
+	ResponseCode        int       `json:"response_code"`
+	ResponseContentType *string   `json:"response_content_type"`
+	ResponseBody        string    `json:"response_body"`
+	AttemptedAt         time.Time `json:"attempted_at"`
+
+	NotificationID string `json:"-"`
+}
+
+// EventType describes a kind of event that can be sent to notification
+// settings.
+type EventType struct {
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	Group             string `json:"group"`
+	AvailableVersions []int  `json:"available_versions"`
+}
+
 // NotificationSetting represents a webhook endpoint configuration.
 type NotificationSetting struct {
 	ID              string    `json:"id"`
@@ -283,3 +541,334 @@ type CreateNotificationSettingRequest struct {
 	IncludeSensitiveFields *bool `json:"include_sensitive_fields,omitempty"`
 	Type            string   `json:"type,omitempty"`
 }
+
+// UpdateNotificationSettingRequest is the body of
+// PATCH /v1/notification-settings/{id}. Omitted fields are left unchanged.
+type UpdateNotificationSettingRequest struct {
+	Description            *string  `json:"description,omitempty"`
+	Destination            *string  `json:"destination,omitempty"`
+	SubscribedEvents       []string `json:"subscribed_events,omitempty"`
+	Active                 *bool    `json:"active,omitempty"`
+	APIVersion             *int     `json:"api_version,omitempty"`
+	IncludeSensitiveFields *bool    `json:"include_sensitive_fields,omitempty"`
+}
+
+// Discount is a percentage or fixed amount off transactions, optionally
+// redeemed with a code at checkout.
+type Discount struct {
+	ID                        string            `json:"id"`
+	Status                    string            `json:"status"` // "active", "archived", "expired", "used"
+	Description               string            `json:"description"`
+	EnabledForCheckout        bool              `json:"enabled_for_checkout"`
+	Code                      *string           `json:"code"`
+	Type                      string            `json:"type"`   // "flat", "flat_per_seat", "percentage"
+	Amount                    string            `json:"amount"` // percent, or lowest currency unit for flat types
+	CurrencyCode              *string           `json:"currency_code"`
+	Recur                     bool              `json:"recur"`
+	MaximumRecurringIntervals *int              `json:"maximum_recurring_intervals"`
+	UsageLimit                *int              `json:"usage_limit"`
+	RestrictTo                []string          `json:"restrict_to"` // product and price IDs
+	ExpiresAt                 *time.Time        `json:"expires_at"`
+	TimesUsed                 int               `json:"times_used"`
+	CustomData                map[string]string `json:"custom_data"`
+	CreatedAt                 time.Time         `json:"created_at"`
+	UpdatedAt                 time.Time         `json:"updated_at"`
+}
+
+type CreateDiscountRequest struct {
+	Description               string            `json:"description"`
+	Type                      string            `json:"type"`
+	Amount                    string            `json:"amount"`
+	CurrencyCode              *string           `json:"currency_code,omitempty"`
+	EnabledForCheckout        bool              `json:"enabled_for_checkout"`
+	Code                      *string           `json:"code,omitempty"`
+	Recur                     bool              `json:"recur"`
+	MaximumRecurringIntervals *int              `json:"maximum_recurring_intervals,omitempty"`
+	UsageLimit                *int              `json:"usage_limit,omitempty"`
+	RestrictTo                []string          `json:"restrict_to,omitempty"`
+	ExpiresAt                 *time.Time        `json:"expires_at,omitempty"`
+	CustomData                map[string]string `json:"custom_data,omitempty"`
+}
+
+type UpdateDiscountRequest struct {
+	Status                    string            `json:"status,omitempty"` // "active" or "archived"
+	Description               *string           `json:"description,omitempty"`
+	Type                      string            `json:"type,omitempty"`
+	Amount                    string            `json:"amount,omitempty"`
+	CurrencyCode              *string           `json:"currency_code,omitempty"`
+	EnabledForCheckout        *bool             `json:"enabled_for_checkout,omitempty"`
+	Code                      *string           `json:"code,omitempty"`
+	Recur                     *bool             `json:"recur,omitempty"`
+	MaximumRecurringIntervals *int              `json:"maximum_recurring_intervals,omitempty"`
+	UsageLimit                *int              `json:"usage_limit,omitempty"`
+	RestrictTo                *[]string         `json:"restrict_to,omitempty"`
+	ExpiresAt                 *time.Time        `json:"expires_at,omitempty"`
+	CustomData                map[string]string `json:"custom_data,omitempty"`
+}
+
+// Report is a CSV export of transactions, adjustments or discounts.
+type Report struct {
+	ID        string         `json:"id"`
+	Status    string         `json:"status"` // "pending", "ready", "expired"
+	Rows      *int           `json:"rows"`
+	Type      string         `json:"type"` // "transactions", "adjustments", "discounts"
+	Filters   []ReportFilter `json:"filters"`
+	ExpiresAt *time.Time     `json:"expires_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+
+	// CSV is the generated file, available for download once the report is
+	// ready.
+	CSV []byte `json:"-"`
+}
+
+// ReportFilter narrows the rows in a report. Value is a string, or a list of
+// strings for any of several values.
+type ReportFilter struct {
+	Name     string      `json:"name"`
+	Operator *string     `json:"operator"` // "lt" or "gte" for updated_at, otherwise null
+	Value    interface{} `json:"value"`
+}
+
+type CreateReportRequest struct {
+	Type    string         `json:"type"`
+	Filters []ReportFilter `json:"filters,omitempty"`
+}
+
+// Simulation sends a single webhook event, or a scenario of events, to a
+// notification setting so webhook handlers can be tested on demand.
+type Simulation struct {
+	ID                    string            `json:"id"`
+	Status                string            `json:"status"` // "active", "archived"
+	NotificationSettingID string            `json:"notification_setting_id"`
+	Name                  string            `json:"name"`
+	Type                  string            `json:"type"` // an event type, or a scenario such as "subscription_creation"
+	Payload               interface{}       `json:"payload"`
+	Config                *SimulationConfig `json:"config"`
+	LastRunAt             *time.Time        `json:"last_run_at"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
+}
+
+// SimulationConfig holds the settings of a scenario simulation. Only the key
+// matching the simulation's type is used.
+type SimulationConfig struct {
+	SubscriptionCreation     *SimulationCreationConfig     `json:"subscription_creation,omitempty"`
+	SubscriptionRenewal      *SimulationRenewalConfig      `json:"subscription_renewal,omitempty"`
+	SubscriptionCancellation *SimulationCancellationConfig `json:"subscription_cancellation,omitempty"`
+}
+
+type SimulationCreationConfig struct {
+	Entities SimulationCreationEntities `json:"entities"`
+}
+
+type SimulationCreationEntities struct {
+	CustomerID    *string `json:"customer_id"`
+	AddressID     *string `json:"address_id"`
+	DiscountID    *string `json:"discount_id"`
+	TransactionID *string `json:"transaction_id"`
+}
+
+type SimulationRenewalConfig struct {
+	Entities SimulationSubscriptionEntities `json:"entities"`
+	Options  SimulationRenewalOptions       `json:"options"`
+}
+
+type SimulationRenewalOptions struct {
+	PaymentOutcome string `json:"payment_outcome"` // "success", "failed"
+}
+
+type SimulationCancellationConfig struct {
+	Entities SimulationSubscriptionEntities `json:"entities"`
+	Options  SimulationCancellationOptions  `json:"options"`
+}
+
+type SimulationCancellationOptions struct {
+	EffectiveFrom string `json:"effective_from"` // "next_billing_period", "immediately"
+}
+
+type SimulationSubscriptionEntities struct {
+	SubscriptionID *string `json:"subscription_id"`
+}
+
+type CreateSimulationRequest struct {
+	NotificationSettingID string            `json:"notification_setting_id"`
+	Name                  string            `json:"name"`
+	Type                  string            `json:"type"`
+	Payload               interface{}       `json:"payload,omitempty"`
+	Config                *SimulationConfig `json:"config,omitempty"`
+}
+
+// UpdateSimulationRequest is the body of PATCH /v1/simulations/{id}. Payload
+// is kept raw so an explicit null (regenerate the payload) can be told apart
+// from leaving it out.
+type UpdateSimulationRequest struct {
+	NotificationSettingID *string           `json:"notification_setting_id,omitempty"`
+	Name                  *string           `json:"name,omitempty"`
+	Type                  *string           `json:"type,omitempty"`
+	Status                *string           `json:"status,omitempty"`
+	Payload               json.RawMessage   `json:"payload,omitempty"`
+	Config                *SimulationConfig `json:"config,omitempty"`
+}
+
+// SimulationRun is one run of a simulation, sending its events in order.
+type SimulationRun struct {
+	ID        string                `json:"id"`
+	Status    string                `json:"status"` // "pending", "completed", "canceled"
+	Type      string                `json:"type"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Events    []*SimulationRunEvent `json:"events,omitempty"` // only with ?include=events
+
+	SimulationID string `json:"-"`
+}
+
+// SimulationRunEvent is one event sent by a simulation run, with the request
+// made and the response from the destination.
+type SimulationRunEvent struct {
+	ID        string                   `json:"id"`
+	Status    string                   `json:"status"` // "pending", "success", "failed", "aborted"
+	EventType string                   `json:"event_type"`
+	Payload   interface{}              `json:"payload"`
+	Request   *SimulationEventRequest  `json:"request"`
+	Response  *SimulationEventResponse `json:"response"`
+	CreatedAt time.Time                `json:"created_at"`
+	UpdatedAt time.Time                `json:"updated_at"`
+
+	RunID string `json:"-"`
+}
+
+type SimulationEventRequest struct {
+	Body string `json:"body"`
+}
+
+type SimulationEventResponse struct {
+	Body       string `json:"body"`
+	StatusCode int    `json:"status_code"`
+}
+
+// PaymentRule is a mock-only test control that changes how the simulated
+// payment processor treats a customer's payments (or everyone's, when
+// CustomerID is nil).
+type PaymentRule struct {
+	ID         string    `json:"id"`
+	CustomerID *string   `json:"customer_id"`
+	Require3DS bool      `json:"require_3ds"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreatePaymentRuleRequest struct {
+	CustomerID *string `json:"customer_id,omitempty"`
+	Require3DS bool    `json:"require_3ds"`
+}
+
+// Adjustment is a refund, credit or chargeback against a billed or completed
+// transaction.
+type Adjustment struct {
+	ID                     string           `json:"id"`
+	Action                 string           `json:"action"` // "refund", "credit", "chargeback", ...
+	Type                   string           `json:"type"`   // "full", "partial"
+	TransactionID          string           `json:"transaction_id"`
+	SubscriptionID         *string          `json:"subscription_id"`
+	CustomerID             string           `json:"customer_id"`
+	Reason                 string           `json:"reason"`
+	CreditAppliedToBalance *bool            `json:"credit_applied_to_balance"`
+	CurrencyCode           string           `json:"currency_code"`
+	Status                 string           `json:"status"` // "pending_approval", "approved", "rejected", "reversed"
+	Items                  []AdjustmentItem `json:"items"`
+	Totals                 AdjustmentTotals `json:"totals"`
+	CreatedAt              time.Time        `json:"created_at"`
+	UpdatedAt              time.Time        `json:"updated_at"`
+}
+
+// AdjustmentItem adjusts one transaction line item.
+type AdjustmentItem struct {
+	ID        string               `json:"id"`
+	ItemID    string               `json:"item_id"` // transaction line item ID
+	Type      string               `json:"type"`    // "full", "partial", "tax", "proration"
+	Amount    string               `json:"amount"`
+	Proration *Proration           `json:"proration"`
+	Totals    AdjustmentItemTotals `json:"totals"`
+}
+
+type AdjustmentItemTotals struct {
+	Subtotal string `json:"subtotal"`
+	Tax      string `json:"tax"`
+	Total    string `json:"total"`
+}
+
+type AdjustmentTotals struct {
+	Subtotal     string `json:"subtotal"`
+	Tax          string `json:"tax"`
+	Total        string `json:"total"`
+	CurrencyCode string `json:"currency_code"`
+}
+
+type CreateAdjustmentRequest struct {
+	Action        string                    `json:"action"`
+	TransactionID string                    `json:"transaction_id"`
+	Reason        string                    `json:"reason"`
+	Type          string                    `json:"type,omitempty"` // "full" or "partial" (default)
+	Items         []CreateAdjustmentItemReq `json:"items,omitempty"`
+}
+
+type CreateAdjustmentItemReq struct {
+	ItemID string `json:"item_id"`
+	Type   string `json:"type"`
+	Amount string `json:"amount,omitempty"`
+}
+
+// OpenChargebackRequest is the body of POST /admin/chargebacks/{transaction_id}.
+type OpenChargebackRequest struct {
+	Reason             string                    `json:"reason,omitempty"`
+	Type               string                    `json:"type,omitempty"` // "full" (default) or "partial"
+	Items              []CreateAdjustmentItemReq `json:"items,omitempty"`
+	CancelSubscription bool                      `json:"cancel_subscription"`
+}
+
+// ReviseTransactionRequest is the body of POST /v1/transactions/{id}/revise.
+// Only details that don't change the amounts charged can be revised.
+type ReviseTransactionRequest struct {
+	Customer *ReviseCustomer `json:"customer,omitempty"`
+	Address  *ReviseAddress  `json:"address,omitempty"`
+	Business *ReviseBusiness `json:"business,omitempty"`
+}
+
+type ReviseCustomer struct {
+	Name *string `json:"name,omitempty"`
+}
+
+type ReviseAddress struct {
+	FirstLine  *string `json:"first_line,omitempty"`
+	SecondLine *string `json:"second_line,omitempty"`
+	City       *string `json:"city,omitempty"`
+	Region     *string `json:"region,omitempty"`
+}
+
+type ReviseBusiness struct {
+	Name          *string `json:"name,omitempty"`
+	CompanyNumber *string `json:"company_number,omitempty"`
+	TaxIdentifier *string `json:"tax_identifier,omitempty"`
+}
+
+// TransactionRevision records one revision of a transaction's billing
+// details, with the details before and after.
+type TransactionRevision struct {
+	ID            string                    `json:"id"`
+	TransactionID string                    `json:"transaction_id"`
+	Previous      TransactionBillingDetails `json:"previous"`
+	Revised       TransactionBillingDetails `json:"revised"`
+	CreatedAt     time.Time                 `json:"created_at"`
+}
+
+// TransactionBillingDetails are the revisable details of a transaction.
+type TransactionBillingDetails struct {
+	CustomerName          *string `json:"customer_name"`
+	AddressFirstLine      *string `json:"address_first_line"`
+	AddressSecondLine     *string `json:"address_second_line"`
+	AddressCity           *string `json:"address_city"`
+	AddressRegion         *string `json:"address_region"`
+	BusinessName          *string `json:"business_name"`
+	BusinessCompanyNumber *string `json:"business_company_number"`
+	BusinessTaxIdentifier *string `json:"business_tax_identifier"`
+}
@@ -0,0 +1,162 @@
+// Package money handles amounts the way Paddle represents them: whole numbers
+// in the lowest denomination of the currency (cents for USD, yen for JPY),
+// sent as strings. Amounts are int64, scaled by rates using exact rational
+// arithmetic and rounded by explicit rules, so totals never pick up
+// floating-point error.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is an amount in the lowest denomination of its currency. Credits
+// and refunds may be negative.
+type Amount int64
+
+// MaxAmount is the largest amount (in absolute value) accepted as input or
+// produced by Mul and Sum. It is well below the int64 limit, so a few amounts
+// within it can be added without checks; callers that add up arbitrarily many
+// amounts use Sum.
+const MaxAmount Amount = 1_000_000_000_000_000
+
+var (
+	ErrInvalid  = errors.New("money: amount must be a whole number in the lowest currency unit")
+	ErrOverflow = errors.New("money: amount out of range")
+)
+
+// Parse reads an amount such as "1500" or "-250". Decimal points, grouping
+// and signs other than a leading minus are rejected.
+func Parse(s string) (Amount, error) {
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || strings.TrimLeft(digits, "0123456789") != "" {
+		return 0, ErrInvalid
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || Amount(n) > MaxAmount || Amount(n) < -MaxAmount {
+		return 0, ErrOverflow
+	}
+	return Amount(n), nil
+}
+
+func (a Amount) String() string {
+	return strconv.FormatInt(int64(a), 10)
+}
+
+// Mul returns a multiplied by n, or ErrOverflow if the result is beyond
+// MaxAmount.
+func (a Amount) Mul(n int64) (Amount, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(n))
+	if product.CmpAbs(big.NewInt(int64(MaxAmount))) > 0 {
+		return 0, ErrOverflow
+	}
+	return Amount(product.Int64()), nil
+}
+
+// Sum returns the total of amounts, or ErrOverflow if it is beyond
+// MaxAmount.
+func Sum(amounts ...Amount) (Amount, error) {
+	total := new(big.Int)
+	for _, a := range amounts {
+		total.Add(total, big.NewInt(int64(a)))
+	}
+	if total.CmpAbs(big.NewInt(int64(MaxAmount))) > 0 {
+		return 0, ErrOverflow
+	}
+	return Amount(total.Int64()), nil
+}
+
+// Rounding is how a fractional amount is rounded to a whole amount.
+type Rounding int
+
+const (
+	// HalfUp rounds to the nearest amount, halves away from zero. Tax is
+	// rounded this way.
+	HalfUp Rounding = iota
+	// HalfEven rounds to the nearest amount, halves to the even neighbour,
+	// which avoids bias when converting many amounts between currencies.
+	HalfEven
+	// Down truncates towards zero. Proration uses it, so a customer is never
+	// charged or credited more than the exact prorated amount.
+	Down
+)
+
+// Scale returns a multiplied by rate, rounded to a whole amount.
+func (a Amount) Scale(rate *big.Rat, mode Rounding) Amount {
+	exact := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rate)
+	return round(exact, mode)
+}
+
+func round(r *big.Rat, mode Rounding) Amount {
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 || mode == Down {
+		return Amount(quo.Int64())
+	}
+
+	// Compare twice the remainder with the denominator to find which
+	// neighbour is nearer.
+	twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	away := false
+	switch twice.Cmp(den) {
+	case 1:
+		away = true
+	case 0:
+		away = mode == HalfUp || quo.Bit(0) == 1
+	}
+	if away {
+		quo.Add(quo, big.NewInt(int64(r.Sign())))
+	}
+	return Amount(quo.Int64())
+}
+
+// ParseRate reads a decimal rate such as a tax rate ("0.19") or proration
+// rate ("0.5161") exactly.
+func ParseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("money: invalid rate %q", s)
+	}
+	return r, nil
+}
+
+// zeroDecimal are the ISO 4217 currencies with no minor unit.
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true,
+	"JPY": true, "KMF": true, "KRW": true, "PYG": true, "RWF": true,
+	"UGX": true, "UYI": true, "VND": true, "VUV": true, "XAF": true,
+	"XOF": true, "XPF": true,
+}
+
+// Decimals is the number of digits after the decimal point in a currency's
+// major unit: 0 for zero-decimal currencies such as JPY, KRW and VND, 2
+// otherwise. It is the only table of minor units in the mock.
+func Decimals(currency string) int {
+	if zeroDecimal[currency] {
+		return 0
+	}
+	return 2
+}
+
+// Format renders an amount for people, e.g. 1500 USD as "15.00 USD",
+// -250 EUR as "-2.50 EUR" and 1500 JPY as "1500 JPY".
+func Format(a Amount, currency string) string {
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	decimals := Decimals(currency)
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d %s", sign, n, currency)
+	}
+	unit := int64(1)
+	for i := 0; i < decimals; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, n/unit, decimals, n%unit, currency)
+}
@@ -0,0 +1,161 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"0", 0, nil},
+		{"1500", 1500, nil},
+		{"-250", -250, nil},
+		{"007", 7, nil},
+		{"1000000000000000", MaxAmount, nil},
+		{"-1000000000000000", -MaxAmount, nil},
+		{"1000000000000001", 0, ErrOverflow},
+		{"-1000000000000001", 0, ErrOverflow},
+		{"99999999999999999999", 0, ErrOverflow},
+		{"", 0, ErrInvalid},
+		{"-", 0, ErrInvalid},
+		{"+5", 0, ErrInvalid},
+		{"15.00", 0, ErrInvalid},
+		{"1,500", 0, ErrInvalid},
+		{" 15", 0, ErrInvalid},
+		{"--5", 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		n    int64
+		want Amount
+		err  error
+	}{
+		{500, 3, 1500, nil},
+		{-250, 4, -1000, nil},
+		{MaxAmount, 1, MaxAmount, nil},
+		{MaxAmount, -1, -MaxAmount, nil},
+		{MaxAmount, 2, 0, ErrOverflow},
+		{500, 1 << 62, 0, ErrOverflow},
+		{-MaxAmount / 2, 3, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Mul(tt.n)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%d.Mul(%d) = %d, %v; want %d, %v", tt.a, tt.n, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	if got, err := Sum(); got != 0 || err != nil {
+		t.Errorf("Sum() = %d, %v; want 0, nil", got, err)
+	}
+	if got, err := Sum(MaxAmount, MaxAmount, -MaxAmount); got != MaxAmount || err != nil {
+		t.Errorf("Sum(max, max, -max) = %d, %v; want %d, nil", got, err, MaxAmount)
+	}
+	if _, err := Sum(MaxAmount, 1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sum(max, 1) error = %v; want ErrOverflow", err)
+	}
+	if _, err := Sum(-MaxAmount, -1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sum(-max, -1) error = %v; want ErrOverflow", err)
+	}
+}
+
+func TestScale(t *testing.T) {
+	half := big.NewRat(1, 2)
+	tests := []struct {
+		a    Amount
+		rate *big.Rat
+		mode Rounding
+		want Amount
+	}{
+		// Exact results are not rounded.
+		{1000, big.NewRat(19, 100), HalfUp, 190},
+		{1000, big.NewRat(19, 100), Down, 190},
+
+		// Halves.
+		{5, half, HalfUp, 3},
+		{5, half, HalfEven, 2},
+		{7, half, HalfEven, 4},
+		{5, half, Down, 2},
+		{-5, half, HalfUp, -3},
+		{-5, half, HalfEven, -2},
+		{-7, half, HalfEven, -4},
+		{-5, half, Down, -2},
+		{150, big.NewRat(19, 100), HalfUp, 29},   // 28.5
+		{150, big.NewRat(19, 100), HalfEven, 28}, // 28.5
+		{250, big.NewRat(19, 100), HalfEven, 48}, // 47.5
+
+		// Nearer one neighbour.
+		{1234, big.NewRat(19, 100), HalfUp, 234},   // 234.46
+		{1234, big.NewRat(19, 100), HalfEven, 234}, // 234.46
+		{1237, big.NewRat(19, 100), HalfUp, 235},   // 235.03
+		{1299, big.NewRat(1, 3), HalfUp, 433},      // 433
+		{1000, big.NewRat(2, 3), HalfUp, 667},      // 666.67
+		{1000, big.NewRat(2, 3), HalfEven, 667},    // 666.67
+		{1000, big.NewRat(2, 3), Down, 666},        // 666.67
+		{-1000, big.NewRat(2, 3), HalfUp, -667},    // -666.67
+		{-1000, big.NewRat(2, 3), Down, -666},      // -666.67
+		{1000, big.NewRat(1, 3), HalfEven, 333},    // 333.33
+		{MaxAmount, big.NewRat(1, 1), HalfUp, MaxAmount},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Scale(tt.rate, tt.mode); got != tt.want {
+			t.Errorf("%d.Scale(%s, %d) = %d; want %d", tt.a, tt.rate.RatString(), tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("0.081")
+	if err != nil || rate.Cmp(big.NewRat(81, 1000)) != 0 {
+		t.Errorf("ParseRate(0.081) = %v, %v; want 81/1000", rate, err)
+	}
+	if _, err := ParseRate("abc"); err == nil {
+		t.Error("ParseRate(abc) succeeded; want an error")
+	}
+}
+
+func TestDecimals(t *testing.T) {
+	for currency, want := range map[string]int{"USD": 2, "EUR": 2, "JPY": 0, "KRW": 0, "VND": 0, "CLP": 0} {
+		if got := Decimals(currency); got != want {
+			t.Errorf("Decimals(%s) = %d; want %d", currency, got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		a        Amount
+		currency string
+		want     string
+	}{
+		{1500, "USD", "15.00 USD"},
+		{5, "USD", "0.05 USD"},
+		{0, "EUR", "0.00 EUR"},
+		{-250, "EUR", "-2.50 EUR"},
+		{-5, "GBP", "-0.05 GBP"},
+		{1500, "JPY", "1500 JPY"},
+		{-1500, "JPY", "-1500 JPY"},
+		{250000, "VND", "250000 VND"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.a, tt.currency); got != tt.want {
+			t.Errorf("Format(%d, %s) = %q; want %q", tt.a, tt.currency, got, tt.want)
+		}
+	}
+}
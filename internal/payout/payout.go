@@ -0,0 +1,119 @@
+// Package payout converts transaction amounts into the seller's balance
+// currency and works out Paddle's fee, for the payout_totals Paddle reports
+// on billed transactions.
+package payout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+)
+
+// Config is the fee and exchange-rate setup, loaded once at startup.
+type Config struct {
+	// Currency is the balance currency payouts are made in.
+	Currency string
+	// FeePercent and FeeFixed make up Paddle's fee on each transaction:
+	// FeePercent of the grand total plus FeeFixed, in the lowest unit of
+	// Currency.
+	FeePercent *big.Rat
+	FeeFixed   money.Amount
+	// Rates is the value of one unit of each currency in USD.
+	Rates map[string]*big.Rat
+}
+
+// DefaultRates are approximate exchange rates for the currencies Paddle
+// supports, as the value of one unit in USD.
+var DefaultRates = map[string]string{
+	"USD": "1", "EUR": "1.08", "GBP": "1.27", "JPY": "0.0067", "AUD": "0.66", "CAD": "0.73",
+	"CHF": "1.12", "HKD": "0.128", "SGD": "0.74", "SEK": "0.095", "ARS": "0.0011",
+	"BRL": "0.19", "CNY": "0.138", "COP": "0.00025", "CZK": "0.043", "DKK": "0.145",
+	"HUF": "0.0027", "ILS": "0.27", "INR": "0.012", "KRW": "0.00074", "MXN": "0.058",
+	"NOK": "0.093", "NZD": "0.60", "PLN": "0.25", "RUB": "0.011", "THB": "0.028",
+	"TRY": "0.031", "TWD": "0.031", "UAH": "0.024", "VND": "0.00004", "ZAR": "0.054",
+}
+
+// Default is Paddle's standard pricing of 5% + 50¢, paid out in USD.
+func Default() Config {
+	rates := make(map[string]*big.Rat, len(DefaultRates))
+	for code, rate := range DefaultRates {
+		rates[code], _ = money.ParseRate(rate)
+	}
+	return Config{Currency: "USD", FeePercent: big.NewRat(5, 1), FeeFixed: 50, Rates: rates}
+}
+
+// LoadRates reads exchange rates from a JSON file of the form
+// {"EUR": 1.08, "GBP": 1.27}, giving the value of one unit in USD, and
+// merges them over the configured rates. Rates are read as the decimals
+// written in the file.
+func (c *Config) LoadRates(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var rates map[string]json.Number
+	if err := dec.Decode(&rates); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	for code, number := range rates {
+		rate, err := money.ParseRate(number.String())
+		if err != nil || rate.Sign() <= 0 {
+			return fmt.Errorf("exchange rate for %s must be positive", code)
+		}
+		c.Rates[strings.ToUpper(code)] = rate
+	}
+	return nil
+}
+
+// Validate checks that the balance currency has an exchange rate.
+func (c Config) Validate() error {
+	if _, ok := c.Rates[c.Currency]; !ok {
+		return fmt.Errorf("no exchange rate for payout currency %s", c.Currency)
+	}
+	return nil
+}
+
+// ExchangeRate is the rate from one unit of currency to the balance
+// currency. ok is false if the currency has no rate.
+func (c Config) ExchangeRate(currency string) (rate *big.Rat, ok bool) {
+	from, ok := c.Rates[currency]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).Quo(from, c.Rates[c.Currency]), true
+}
+
+// Convert converts amount, in the lowest unit of currency, to the lowest unit
+// of the balance currency, allowing for currencies with different numbers of
+// decimals (JPY has none, USD two). Currencies without a rate convert to 0.
+func (c Config) Convert(amount money.Amount, currency string) money.Amount {
+	factor, ok := c.ExchangeRate(currency)
+	if !ok {
+		return 0
+	}
+	shift := money.Decimals(c.Currency) - money.Decimals(currency)
+	for ; shift > 0; shift-- {
+		factor.Mul(factor, big.NewRat(10, 1))
+	}
+	for ; shift < 0; shift++ {
+		factor.Mul(factor, big.NewRat(1, 10))
+	}
+	return amount.Scale(factor, money.HalfEven)
+}
+
+// Fee is Paddle's fee on a grand total already converted to the balance
+// currency. Nothing is charged on free transactions.
+func (c Config) Fee(grandTotal money.Amount) money.Amount {
+	if grandTotal <= 0 {
+		return 0
+	}
+	percent := new(big.Rat).Quo(c.FeePercent, big.NewRat(100, 1))
+	return grandTotal.Scale(percent, money.HalfUp) + c.FeeFixed
+}
@@ -80,6 +80,34 @@ func Load(s *store.Store) {
 		UpdatedAt:  now,
 	})
 
+	// Addresses
+	s.SetAddress(&models.Address{
+		ID:          "add_test_alice",
+		CustomerID:  "ctm_test_alice",
+		FirstLine:   strPtr("1 Market Street"),
+		City:        strPtr("San Francisco"),
+		PostalCode:  strPtr("94105"),
+		Region:      strPtr("CA"),
+		CountryCode: "US",
+		Status:      "active",
+		CustomData:  map[string]string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+
+	s.SetAddress(&models.Address{
+		ID:          "add_test_bob",
+		CustomerID:  "ctm_test_bob",
+		FirstLine:   strPtr("10 Unter den Linden"),
+		City:        strPtr("Berlin"),
+		PostalCode:  strPtr("10117"),
+		CountryCode: "DE",
+		Status:      "active",
+		CustomData:  map[string]string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+
 	// Subscription for Alice (trialing, trial ends in 90 days)
 	trialEnd := now.Add(90 * 24 * time.Hour)
 	product, _ := s.GetProduct("prod_yieldly_base")
@@ -89,6 +117,7 @@ func Load(s *store.Store) {
 		ID:             "sub_test_alice",
 		Status:         "trialing",
 		CustomerID:     "ctm_test_alice",
+		AddressID:      strPtr("add_test_alice"),
 		CurrencyCode:   "USD",
 		CreatedAt:      now,
 		UpdatedAt:      now,
@@ -1,9 +1,12 @@
 package store
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
 )
@@ -15,6 +18,25 @@ func NextID(prefix string) string {
 	return fmt.Sprintf("%s_%08d", prefix, n)
 }
 
+// NewUUID returns a random (version 4) UUID, the format Paddle uses for
+// payment attempt and stored payment method IDs.
+func NewUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+var invoiceCounter uint64
+
+// NextInvoiceNumber returns a sequential invoice number, assigned to
+// transactions when they are billed.
+func NextInvoiceNumber() string {
+	n := atomic.AddUint64(&invoiceCounter, 1)
+	return fmt.Sprintf("%d-%05d", time.Now().UTC().Year(), n)
+}
+
 // Store is the thread-safe in-memory data store for all Paddle resources.
 type Store struct {
 	mu sync.RWMutex
@@ -22,10 +44,22 @@ type Store struct {
 	Products             map[string]*models.Product
 	Prices               map[string]*models.Price
 	Customers            map[string]*models.Customer
+	Addresses            map[string]*models.Address
+	Businesses           map[string]*models.Business
 	Subscriptions        map[string]*models.Subscription
 	Transactions         map[string]*models.Transaction
+	Adjustments          map[string]*models.Adjustment
+	Discounts            map[string]*models.Discount
+	Reports              map[string]*models.Report
+	Simulations          map[string]*models.Simulation
+	SimulationRuns       map[string]*models.SimulationRun
+	SimulationRunEvents  map[string]*models.SimulationRunEvent
+	Revisions            []*models.TransactionRevision
 	Events               []*models.Event
 	NotificationSettings map[string]*models.NotificationSetting
+	Notifications        map[string]*models.Notification
+	NotificationLogs     []*models.NotificationLog
+	PaymentRules         map[string]*models.PaymentRule
 }
 
 func New() *Store {
@@ -33,10 +67,22 @@ func New() *Store {
 		Products:             make(map[string]*models.Product),
 		Prices:               make(map[string]*models.Price),
 		Customers:            make(map[string]*models.Customer),
+		Addresses:            make(map[string]*models.Address),
+		Businesses:           make(map[string]*models.Business),
 		Subscriptions:        make(map[string]*models.Subscription),
 		Transactions:         make(map[string]*models.Transaction),
+		Adjustments:          make(map[string]*models.Adjustment),
+		Discounts:            make(map[string]*models.Discount),
+		Reports:              make(map[string]*models.Report),
+		Simulations:          make(map[string]*models.Simulation),
+		SimulationRuns:       make(map[string]*models.SimulationRun),
+		SimulationRunEvents:  make(map[string]*models.SimulationRunEvent),
+		Revisions:            make([]*models.TransactionRevision, 0),
 		Events:               make([]*models.Event, 0),
 		NotificationSettings: make(map[string]*models.NotificationSetting),
+		Notifications:        make(map[string]*models.Notification),
+		NotificationLogs:     make([]*models.NotificationLog, 0),
+		PaymentRules:         make(map[string]*models.PaymentRule),
 	}
 }
 
@@ -47,10 +93,22 @@ func (s *Store) Reset() {
 	s.Products = make(map[string]*models.Product)
 	s.Prices = make(map[string]*models.Price)
 	s.Customers = make(map[string]*models.Customer)
+	s.Addresses = make(map[string]*models.Address)
+	s.Businesses = make(map[string]*models.Business)
 	s.Subscriptions = make(map[string]*models.Subscription)
 	s.Transactions = make(map[string]*models.Transaction)
+	s.Adjustments = make(map[string]*models.Adjustment)
+	s.Discounts = make(map[string]*models.Discount)
+	s.Reports = make(map[string]*models.Report)
+	s.Simulations = make(map[string]*models.Simulation)
+	s.SimulationRuns = make(map[string]*models.SimulationRun)
+	s.SimulationRunEvents = make(map[string]*models.SimulationRunEvent)
+	s.Revisions = make([]*models.TransactionRevision, 0)
 	s.Events = make([]*models.Event, 0)
 	s.NotificationSettings = make(map[string]*models.NotificationSetting)
+	s.Notifications = make(map[string]*models.Notification)
+	s.NotificationLogs = make([]*models.NotificationLog, 0)
+	s.PaymentRules = make(map[string]*models.PaymentRule)
 }
 
 // --- Products ---
@@ -128,6 +186,49 @@ func (s *Store) SetCustomer(c *models.Customer) {
 	s.Customers[c.ID] = c
 }
 
+// --- Addresses ---
+
+func (s *Store) GetAddress(id string) (*models.Address, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.Addresses[id]
+	return a, ok
+}
+
+// ListAddresses returns the addresses belonging to a customer.
+func (s *Store) ListAddresses(customerID string) []*models.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Address, 0)
+	for _, a := range s.Addresses {
+		if a.CustomerID == customerID {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (s *Store) SetAddress(a *models.Address) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Addresses[a.ID] = a
+}
+
+// --- Businesses ---
+
+func (s *Store) GetBusiness(id string) (*models.Business, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.Businesses[id]
+	return b, ok
+}
+
+func (s *Store) SetBusiness(b *models.Business) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Businesses[b.ID] = b
+}
+
 // --- Subscriptions ---
 
 func (s *Store) GetSubscription(id string) (*models.Subscription, bool) {
@@ -178,11 +279,253 @@ func (s *Store) SetTransaction(t *models.Transaction) {
 	s.Transactions[t.ID] = t
 }
 
+// --- Adjustments ---
+
+func (s *Store) GetAdjustment(id string) (*models.Adjustment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	adj, ok := s.Adjustments[id]
+	return adj, ok
+}
+
+// ListAdjustments returns all adjustments, or those against one transaction
+// if transactionID is not empty.
+func (s *Store) ListAdjustments(transactionID string) []*models.Adjustment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Adjustment, 0)
+	for _, adj := range s.Adjustments {
+		if transactionID == "" || adj.TransactionID == transactionID {
+			result = append(result, adj)
+		}
+	}
+	return result
+}
+
+func (s *Store) SetAdjustment(adj *models.Adjustment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Adjustments[adj.ID] = adj
+}
+
+// AddAdjustment stores the new adjustment adj unless check, given the
+// adjustments already made against the same transaction, returns an error.
+// The store is locked throughout, so two adjustments can't both pass a check
+// of what is left to adjust.
+func (s *Store) AddAdjustment(adj *models.Adjustment, check func(existing []*models.Adjustment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := make([]*models.Adjustment, 0)
+	for _, other := range s.Adjustments {
+		if other.TransactionID == adj.TransactionID {
+			existing = append(existing, other)
+		}
+	}
+	if err := check(existing); err != nil {
+		return err
+	}
+	s.Adjustments[adj.ID] = adj
+	return nil
+}
+
+// --- Discounts ---
+
+func (s *Store) GetDiscount(id string) (*models.Discount, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.Discounts[id]
+	return d, ok
+}
+
+func (s *Store) ListDiscounts() []*models.Discount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Discount, 0, len(s.Discounts))
+	for _, d := range s.Discounts {
+		result = append(result, d)
+	}
+	return result
+}
+
+func (s *Store) SetDiscount(d *models.Discount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Discounts[d.ID] = d
+}
+
+// ErrDiscountNotFound is returned by UpdateDiscount for an unknown discount.
+var ErrDiscountNotFound = errors.New("discount not found")
+
+// UpdateDiscount applies update to a copy of discount id and stores the copy,
+// unless update returns an error. The store is locked throughout, so checks
+// made by update, such as against a usage limit, can't be raced by another
+// update.
+func (s *Store) UpdateDiscount(id string, update func(d *models.Discount) error) (*models.Discount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.Discounts[id]
+	if !ok {
+		return nil, ErrDiscountNotFound
+	}
+	updated := *d
+	if err := update(&updated); err != nil {
+		return nil, err
+	}
+	s.Discounts[id] = &updated
+	return &updated, nil
+}
+
+// --- Reports ---
+
+func (s *Store) GetReport(id string) (*models.Report, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rep, ok := s.Reports[id]
+	return rep, ok
+}
+
+func (s *Store) ListReports() []*models.Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Report, 0, len(s.Reports))
+	for _, rep := range s.Reports {
+		result = append(result, rep)
+	}
+	return result
+}
+
+func (s *Store) SetReport(rep *models.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reports[rep.ID] = rep
+}
+
+// UpdateReport applies update to a copy of report id and stores the copy if
+// update reports a change. The check and the write happen under one lock, so
+// of several concurrent callers making the same status change, only one sees
+// changed == true. It returns nil for an unknown report.
+func (s *Store) UpdateReport(id string, update func(r *models.Report) bool) (rep *models.Report, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.Reports[id]
+	if !ok {
+		return nil, false
+	}
+	updated := *r
+	if !update(&updated) {
+		return r, false
+	}
+	s.Reports[id] = &updated
+	return &updated, true
+}
+
+// --- Simulations ---
+
+func (s *Store) GetSimulation(id string) (*models.Simulation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sim, ok := s.Simulations[id]
+	return sim, ok
+}
+
+func (s *Store) ListSimulations() []*models.Simulation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Simulation, 0, len(s.Simulations))
+	for _, sim := range s.Simulations {
+		result = append(result, sim)
+	}
+	return result
+}
+
+func (s *Store) SetSimulation(sim *models.Simulation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Simulations[sim.ID] = sim
+}
+
+func (s *Store) GetSimulationRun(id string) (*models.SimulationRun, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	run, ok := s.SimulationRuns[id]
+	return run, ok
+}
+
+// ListSimulationRuns returns the runs of a simulation.
+func (s *Store) ListSimulationRuns(simulationID string) []*models.SimulationRun {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.SimulationRun, 0)
+	for _, run := range s.SimulationRuns {
+		if run.SimulationID == simulationID {
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+func (s *Store) SetSimulationRun(run *models.SimulationRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SimulationRuns[run.ID] = run
+}
+
+func (s *Store) GetSimulationRunEvent(id string) (*models.SimulationRunEvent, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.SimulationRunEvents[id]
+	return e, ok
+}
+
+// ListSimulationRunEvents returns the events sent by a simulation run.
+func (s *Store) ListSimulationRunEvents(runID string) []*models.SimulationRunEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.SimulationRunEvent, 0)
+	for _, e := range s.SimulationRunEvents {
+		if e.RunID == runID {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (s *Store) SetSimulationRunEvent(e *models.SimulationRunEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SimulationRunEvents[e.ID] = e
+}
+
+// --- Transaction Revisions ---
+
+func (s *Store) AddRevision(rev *models.TransactionRevision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Revisions = append(s.Revisions, rev)
+}
+
+// ListRevisions returns the revisions of a transaction, oldest first.
+func (s *Store) ListRevisions(transactionID string) []*models.TransactionRevision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.TransactionRevision, 0)
+	for _, rev := range s.Revisions {
+		if rev.TransactionID == transactionID {
+			result = append(result, rev)
+		}
+	}
+	return result
+}
+
 // --- Events ---
 
+// AddEvent gives e the next event ID and stores it. The ID is assigned under
+// the lock, so Events is always in ID order and an event can't be appended
+// behind one a poller has already seen.
 func (s *Store) AddEvent(e *models.Event) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	e.EventID = NextID("evt")
 	s.Events = append(s.Events, e)
 }
 
@@ -218,3 +561,125 @@ func (s *Store) SetNotificationSetting(ns *models.NotificationSetting) {
 	defer s.mu.Unlock()
 	s.NotificationSettings[ns.ID] = ns
 }
+
+func (s *Store) DeleteNotificationSetting(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.NotificationSettings[id]; !ok {
+		return false
+	}
+	delete(s.NotificationSettings, id)
+	return true
+}
+
+// --- Notifications ---
+
+func (s *Store) GetNotification(id string) (*models.Notification, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ntf, ok := s.Notifications[id]
+	return ntf, ok
+}
+
+func (s *Store) ListNotifications() []*models.Notification {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.Notification, 0, len(s.Notifications))
+	for _, ntf := range s.Notifications {
+		result = append(result, ntf)
+	}
+	return result
+}
+
+func (s *Store) SetNotification(ntf *models.Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Notifications[ntf.ID] = ntf
+}
+
+// MarkNotificationReplayed records that notification id was replayed at t,
+// leaving the rest of it, such as a delivery in progress, as it is. It
+// reports whether the notification exists.
+func (s *Store) MarkNotificationReplayed(id string, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ntf, ok := s.Notifications[id]
+	if !ok {
+		return false
+	}
+	// Readers may hold the stored notification, so it is replaced, not changed.
+	updated := *ntf
+	updated.ReplayedAt = &t
+	s.Notifications[id] = &updated
+	return true
+}
+
+// UpdateNotificationDelivery copies the delivery state of ntf, its status,
+// attempt count and their times, to the stored notification with its ID. The
+// rest, such as replayed_at set while it was being sent, is left as it is. It
+// reports whether the notification exists.
+func (s *Store) UpdateNotificationDelivery(ntf *models.Notification) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.Notifications[ntf.ID]
+	if !ok {
+		return false
+	}
+	updated := *stored
+	updated.Status = ntf.Status
+	updated.DeliveredAt = ntf.DeliveredAt
+	updated.LastAttemptAt = ntf.LastAttemptAt
+	updated.RetryAt = ntf.RetryAt
+	updated.TimesAttempted = ntf.TimesAttempted
+	s.Notifications[ntf.ID] = &updated
+	return true
+}
+
+func (s *Store) AddNotificationLog(entry *models.NotificationLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NotificationLogs = append(s.NotificationLogs, entry)
+}
+
+// ListNotificationLogs returns the delivery attempts of a notification,
+// oldest first.
+func (s *Store) ListNotificationLogs(notificationID string) []*models.NotificationLog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.NotificationLog, 0)
+	for _, entry := range s.NotificationLogs {
+		if entry.NotificationID == notificationID {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// --- Payment Rules ---
+
+func (s *Store) ListPaymentRules() []*models.PaymentRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.PaymentRule, 0, len(s.PaymentRules))
+	for _, rule := range s.PaymentRules {
+		result = append(result, rule)
+	}
+	return result
+}
+
+func (s *Store) SetPaymentRule(rule *models.PaymentRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.PaymentRules[rule.ID] = rule
+}
+
+// DeletePaymentRule removes a payment rule, reporting whether it existed.
+func (s *Store) DeletePaymentRule(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.PaymentRules[id]; !ok {
+		return false
+	}
+	delete(s.PaymentRules, id)
+	return true
+}
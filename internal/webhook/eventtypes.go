@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"strings"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+)
+
+// EventTypes is the catalog of events the mock can send, grouped by entity.
+// Every event type is fired by the mock's own handlers and emitted by API
+// version 1.
+var EventTypes = []models.EventType{
+	eventType("address.created", "Address", "Occurs when an address is created."),
+	eventType("adjustment.created", "Adjustment", "Occurs when an adjustment is created."),
+	eventType("adjustment.updated", "Adjustment", "Occurs when an adjustment is updated, such as when a refund is approved or a chargeback is reversed."),
+	eventType("customer.created", "Customer", "Occurs when a customer is created."),
+	eventType("customer.updated", "Customer", "Occurs when a customer is updated."),
+	eventType("discount.created", "Discount", "Occurs when a discount is created."),
+	eventType("discount.updated", "Discount", "Occurs when a discount is updated."),
+	eventType("report.created", "Report", "Occurs when a report is created."),
+	eventType("report.updated", "Report", "Occurs when a report is updated, such as when it is ready to download."),
+	eventType("subscription.activated", "Subscription", "Occurs when a subscription becomes active after its trial or first payment."),
+	eventType("subscription.canceled", "Subscription", "Occurs when a subscription is canceled."),
+	eventType("subscription.created", "Subscription", "Occurs when a subscription is created."),
+	eventType("subscription.past_due", "Subscription", "Occurs when a subscription has an unpaid transaction."),
+	eventType("subscription.paused", "Subscription", "Occurs when a subscription is paused."),
+	eventType("subscription.resumed", "Subscription", "Occurs when a paused subscription is resumed."),
+	eventType("subscription.trialing", "Subscription", "Occurs when a subscription enters its trial period."),
+	eventType("subscription.updated", "Subscription", "Occurs when a subscription is updated, including when it renews."),
+	eventType("transaction.billed", "Transaction", "Occurs when a transaction is billed."),
+	eventType("transaction.canceled", "Transaction", "Occurs when a transaction is canceled."),
+	eventType("transaction.completed", "Transaction", "Occurs when a transaction is completed and processing after payment is done."),
+	eventType("transaction.created", "Transaction", "Occurs when a transaction is created."),
+	eventType("transaction.paid", "Transaction", "Occurs when a transaction is paid."),
+	eventType("transaction.past_due", "Transaction", "Occurs when a transaction becomes past due."),
+	eventType("transaction.payment_failed", "Transaction", "Occurs when a payment attempt for a transaction fails."),
+	eventType("transaction.ready", "Transaction", "Occurs when a transaction is ready to be paid."),
+	eventType("transaction.revised", "Transaction", "Occurs when the customer, address or business details of a billed or completed transaction are revised."),
+	eventType("transaction.updated", "Transaction", "Occurs when a transaction is updated."),
+}
+
+func eventType(name, group, description string) models.EventType {
+	return models.EventType{
+		Name:              name,
+		Description:       description,
+		Group:             group,
+		AvailableVersions: []int{1},
+	}
+}
+
+// IsEventType reports whether name is in the event type catalog.
+func IsEventType(name string) bool {
+	for _, et := range EventTypes {
+		if et.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EventTypeNames returns the name of every event type in the catalog. New
+// notification settings subscribe to all of them by default.
+func EventTypeNames() []string {
+	names := make([]string, 0, len(EventTypes))
+	for _, et := range EventTypes {
+		names = append(names, et.Name)
+	}
+	return names
+}
+
+// IsSubscribable reports whether name can be listed in a notification
+// setting's subscribed events: an event type from the catalog, "*" for every
+// event, or a wildcard such as "subscription.*" for every event of an entity.
+func IsSubscribable(name string) bool {
+	if name == "*" {
+		return true
+	}
+	if group, ok := strings.CutSuffix(name, ".*"); ok {
+		for _, et := range EventTypes {
+			if strings.HasPrefix(et.Name, group+".") {
+				return true
+			}
+		}
+		return false
+	}
+	return IsEventType(name)
+}
+
+// Subscribed reports whether ns subscribes to eventType, directly or through
+// a wildcard.
+func Subscribed(ns *models.NotificationSetting, eventType string) bool {
+	for _, name := range ns.SubscribedEvents {
+		if name == "*" || name == eventType {
+			return true
+		}
+		if group, ok := strings.CutSuffix(name, ".*"); ok && strings.HasPrefix(eventType, group+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vlah-software-house/paddle-api-mock/internal/models"
+	"github.com/vlah-software-house/paddle-api-mock/internal/money"
+)
+
+// APIVersions are the webhook payload formats the mock can send. A
+// notification setting's api_version picks one.
+var APIVersions = []int{1}
+
+// IsAPIVersion reports whether v is a supported webhook API version.
+func IsAPIVersion(v int) bool {
+	for _, version := range APIVersions {
+		if version == v {
+			return true
+		}
+	}
+	return false
+}
+
+// timeFormat is how Paddle writes timestamps in webhooks: RFC 3339 in UTC,
+// with microseconds.
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// envelope is the body of a webhook. Each notification of an event gets its
+// own, as it carries the notification's ID.
+type envelope struct {
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	OccurredAt     string          `json:"occurred_at"`
+	NotificationID string          `json:"notification_id"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// Payload builds the body of the webhook for event sent as notification
+// notificationID, in the format of apiVersion.
+func (n *Notifier) Payload(apiVersion int, event *models.Event, notificationID string) ([]byte, error) {
+	if !IsAPIVersion(apiVersion) {
+		return nil, fmt.Errorf("unsupported API version %d", apiVersion)
+	}
+	data, err := jsonValue(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	if entity, ok := data.(map[string]interface{}); ok {
+		n.shapeV1(event.EventType, entity)
+	}
+	formatTimes(data)
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&envelope{
+		EventID:        event.EventID,
+		EventType:      event.EventType,
+		OccurredAt:     event.OccurredAt.UTC().Format(timeFormat),
+		NotificationID: notificationID,
+		Data:           raw,
+	})
+}
+
+// withNotificationID returns payload as sent for another notification of the
+// same event.
+func withNotificationID(payload []byte, notificationID string) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return nil, err
+	}
+	env.NotificationID = notificationID
+	return json.Marshal(&env)
+}
+
+// jsonValue converts v to the generic form encoding/json decodes into, so
+// fields can be added and removed. Numbers are kept exactly as marshaled.
+func jsonValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out interface{}
+	err = dec.Decode(&out)
+	return out, err
+}
+
+// formatTimes rewrites the timestamps in v, the fields ending in "_at", in
+// timeFormat. Custom data is left as the seller set it.
+func formatTimes(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key == "custom_data" {
+				continue
+			}
+			if s, ok := value.(string); ok && strings.HasSuffix(key, "_at") {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					v[key] = t.UTC().Format(timeFormat)
+				}
+				continue
+			}
+			formatTimes(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			formatTimes(value)
+		}
+	}
+}
+
+// shapeV1 turns an entity as the API returns it into the entity Paddle sends
+// in version 1 webhooks: related entities that are only returned with
+// ?include are dropped, and fields the mock doesn't track are sent with the
+// values Paddle gives them.
+func (n *Notifier) shapeV1(eventType string, m map[string]interface{}) {
+	entity, _, _ := strings.Cut(eventType, ".")
+	switch entity {
+	case "address", "discount":
+		setDefault(m, "import_meta", nil)
+	case "adjustment":
+		shapeAdjustment(m)
+	case "customer":
+		setDefault(m, "marketing_consent", false)
+		setDefault(m, "import_meta", nil)
+	case "subscription":
+		n.shapeSubscription(eventType, m)
+	case "transaction":
+		n.shapeTransaction(m)
+	}
+}
+
+func shapeProduct(m map[string]interface{}) {
+	setDefault(m, "type", "standard")
+	setDefault(m, "import_meta", nil)
+}
+
+func shapePrice(m map[string]interface{}) {
+	delete(m, "product")
+	setDefault(m, "import_meta", nil)
+}
+
+func (n *Notifier) shapeSubscription(eventType string, m map[string]interface{}) {
+	// Management URLs are only returned when getting a subscription.
+	delete(m, "management_urls")
+	setDefault(m, "import_meta", nil)
+	if eventType == "subscription.created" {
+		id, _ := m["id"].(string)
+		setDefault(m, "transaction_id", n.firstTransactionID(id))
+	}
+
+	for _, item := range objects(m["items"]) {
+		price, ok := item["price"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		shapePrice(price)
+		// Subscription items carry their product in webhooks.
+		if item["product"] == nil {
+			productID, _ := price["product_id"].(string)
+			if product, ok := n.Store.GetProduct(productID); ok {
+				item["product"], _ = jsonValue(product)
+			}
+		}
+		if product, ok := item["product"].(map[string]interface{}); ok {
+			shapeProduct(product)
+		}
+	}
+}
+
+// firstTransactionID returns the ID of the transaction that created
+// subscription id, or nil if it has none.
+func (n *Notifier) firstTransactionID(id string) interface{} {
+	var first *models.Transaction
+	for _, txn := range n.Store.ListTransactions() {
+		if txn.SubscriptionID == nil || *txn.SubscriptionID != id {
+			continue
+		}
+		if first == nil || txn.CreatedAt.Before(first.CreatedAt) || txn.CreatedAt.Equal(first.CreatedAt) && txn.ID < first.ID {
+			first = txn
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first.ID
+}
+
+func (n *Notifier) shapeTransaction(m map[string]interface{}) {
+	setDefault(m, "invoice_id", nil)
+	setDefault(m, "billing_details", nil)
+
+	for _, item := range objects(m["items"]) {
+		delete(item, "product")
+		if price, ok := item["price"].(map[string]interface{}); ok {
+			shapePrice(price)
+		}
+	}
+	for _, payment := range objects(m["payments"]) {
+		setDefault(payment, "payment_method_id", nil)
+	}
+
+	details, ok := m["details"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	setDefault(details, "adjusted_payout_totals", nil)
+	for _, line := range objects(details["line_items"]) {
+		if product, ok := line["product"].(map[string]interface{}); ok {
+			shapeProduct(product)
+		}
+	}
+}
+
+func shapeAdjustment(m map[string]interface{}) {
+	setDefault(m, "payout_totals", nil)
+	totals, ok := m["totals"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	// Paddle keeps its fee on adjustments, so the seller gives up the
+	// adjusted amount before tax.
+	setDefault(totals, "fee", "0")
+	if _, ok := totals["earnings"]; !ok {
+		total, _ := money.Parse(fmt.Sprint(totals["total"]))
+		tax, _ := money.Parse(fmt.Sprint(totals["tax"]))
+		totals["earnings"] = (total - tax).String()
+	}
+}
+
+// setDefault sets m[key] to value unless m already has the key.
+func setDefault(m map[string]interface{}, key string, value interface{}) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+// objects returns the objects in v, a JSON array.
+func objects(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, value := range list {
+		if m, ok := value.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+// maxRetryDelay caps the backoff between retries.
+const maxRetryDelay = time.Hour
+
+// enqueue adds a notification to the queue of url. The caller must have
+// added it to n.pending.
+func (n *Notifier) enqueue(url, id string) {
+	n.enqueueJob(url, func() { n.deliver(url, id) })
+}
+
+// Queue adds send to the queue of url, to be run once the deliveries queued
+// before it are sent, so what it sends arrives in order with the
+// notifications. Drain waits for it.
+func (n *Notifier) Queue(url string, send func()) {
+	n.pending.Add(1)
+	n.enqueueJob(url, send)
+}
+
+// enqueueJob adds job to the queue of url, starting a worker for the
+// destination if it has none.
+func (n *Notifier) enqueueJob(url string, job func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, running := n.queues[url]
+	n.queues[url] = append(n.queues[url], job)
+	if !running {
+		go n.work(url)
+	}
+}
+
+// work runs the deliveries queued for url one at a time, so a destination
+// receives them in the order they were fired. It returns once the queue is
+// empty.
+func (n *Notifier) work(url string) {
+	for {
+		n.mu.Lock()
+		queue := n.queues[url]
+		if len(queue) == 0 {
+			delete(n.queues, url)
+			n.mu.Unlock()
+			return
+		}
+		job := queue[0]
+		n.queues[url] = queue[1:]
+		n.mu.Unlock()
+
+		job()
+		n.pending.Done()
+	}
+}
+
+// deliver makes one attempt to send a notification, scheduling a retry if it
+// fails and has retries left. Notifications removed by a reset are dropped.
+func (n *Notifier) deliver(url, id string) {
+	stored, ok := n.Store.GetNotification(id)
+	if !ok {
+		return
+	}
+	// Update a copy, as API requests may be reading the stored notification,
+	// and store only its delivery state, as it may be replayed meanwhile.
+	ntf := *stored
+	n.attempt(&ntf, url)
+	if ntf.Status == "delivered" {
+		n.Store.UpdateNotificationDelivery(&ntf)
+		return
+	}
+
+	delay, retry := n.retryDelay(ntf.TimesAttempted)
+	if retry {
+		retryAt := time.Now().UTC().Add(delay)
+		ntf.Status = "needs_retry"
+		ntf.RetryAt = &retryAt
+	}
+	if !n.Store.UpdateNotificationDelivery(&ntf) {
+		return
+	}
+	if retry {
+		n.scheduleRetry(id, delay)
+	}
+}
+
+// retryDelay returns how long to wait before retrying a notification that has
+// failed attempts times, and whether it should be retried at all.
+func (n *Notifier) retryDelay(attempts int) (time.Duration, bool) {
+	n.mu.Lock()
+	draining := n.draining
+	n.mu.Unlock()
+	if draining || attempts > n.MaxRetries {
+		return 0, false
+	}
+	delay := n.RetryInterval
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay), true
+}
+
+func (n *Notifier) scheduleRetry(id string, delay time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending.Add(1)
+	if n.draining {
+		// Drain started after the delay was worked out: retry straight away.
+		go n.retry(id)
+		return
+	}
+	n.retries[id] = time.AfterFunc(delay, func() { n.retry(id) })
+}
+
+// retry queues a notification again, for the current destination of its
+// notification setting. It fails if the setting has been deleted.
+func (n *Notifier) retry(id string) {
+	n.mu.Lock()
+	delete(n.retries, id)
+	n.mu.Unlock()
+
+	stored, ok := n.Store.GetNotification(id)
+	if !ok {
+		n.pending.Done()
+		return
+	}
+	ns, ok := n.Store.GetNotificationSetting(stored.NotificationSettingID)
+	if !ok {
+		ntf := *stored
+		ntf.Status = "failed"
+		ntf.RetryAt = nil
+		n.Store.UpdateNotificationDelivery(&ntf)
+		n.pending.Done()
+		return
+	}
+	n.enqueue(ns.Destination, id)
+}
+
+// Drain waits for every queued delivery to be sent. Scheduled retries are
+// attempted straight away, and failures are not retried again. It returns
+// ctx's error if ctx is done first.
+func (n *Notifier) Drain(ctx context.Context) error {
+	n.mu.Lock()
+	n.draining = true
+	retries := n.retries
+	n.retries = make(map[string]*time.Timer)
+	n.mu.Unlock()
+
+	for id, timer := range retries {
+		// A timer that has already fired is queueing its retry itself.
+		if timer.Stop() {
+			n.retry(id)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -5,21 +5,35 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/vlah-software-house/paddle-api-mock/internal/models"
 	"github.com/vlah-software-house/paddle-api-mock/internal/store"
 )
 
-// Notifier handles firing webhooks to registered endpoints.
+// Notifier handles firing webhooks to registered endpoints. Deliveries are
+// queued and sent in the background, in order for each destination, with
+// failed ones retried on an exponential backoff.
 type Notifier struct {
 	Store         *store.Store
 	SigningSecret string
 	Client        *http.Client
+	// MaxRetries is how many times a failed delivery is retried.
+	MaxRetries int
+	// RetryInterval is the delay before the first retry. Each retry after
+	// that waits twice as long, up to maxRetryDelay.
+	RetryInterval time.Duration
+
+	mu       sync.Mutex
+	queues   map[string][]func()    // deliveries waiting to be sent, by destination
+	retries  map[string]*time.Timer // scheduled retries, by notification ID
+	draining bool
+	pending  sync.WaitGroup // queued deliveries and scheduled retries
 }
 
 func New(s *store.Store, signingSecret string) *Notifier {
@@ -27,35 +41,127 @@ func New(s *store.Store, signingSecret string) *Notifier {
 		Store:         s,
 		SigningSecret: signingSecret,
 		Client:        &http.Client{Timeout: 10 * time.Second},
+		MaxRetries:    3,
+		RetryInterval: 2 * time.Minute,
+		queues:        make(map[string][]func()),
+		retries:       make(map[string]*time.Timer),
 	}
 }
 
-// Fire creates an event and sends it to all registered webhook endpoints.
+// Fire creates an event and queues it for every active webhook endpoint
+// subscribed to its type. Each delivery is recorded as a notification.
 func (n *Notifier) Fire(eventType string, data interface{}) {
 	event := &models.Event{
-		EventID:    store.NextID("evt"),
 		EventType:  eventType,
 		OccurredAt: time.Now().UTC(),
 		Data:       data,
 	}
 	n.Store.AddEvent(event)
 
-	payload, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("webhook: failed to marshal event: %v", err)
-		return
-	}
-
 	settings := n.Store.ListNotificationSettings()
 	for _, ns := range settings {
-		if !ns.Active {
+		if !ns.Active || !Subscribed(ns, eventType) {
 			continue
 		}
-		n.send(ns.Destination, payload)
+		// The payload is taken now, as the entity may change before it is sent.
+		id := store.NextID("ntf")
+		payload, err := n.Payload(ns.APIVersion, event, id)
+		if err != nil {
+			log.Printf("webhook: failed to build %s payload for %s: %v", eventType, ns.ID, err)
+			continue
+		}
+		n.notify(ns, &models.Notification{
+			ID:                    id,
+			Type:                  eventType,
+			Status:                "not_attempted",
+			Payload:               payload,
+			OccurredAt:            event.OccurredAt,
+			Origin:                "event",
+			NotificationSettingID: ns.ID,
+		})
+	}
+}
+
+// Replay queues the event of ntf for ns again as a new notification, which is
+// returned. The payload is the same apart from its notification_id.
+func (n *Notifier) Replay(ntf *models.Notification, ns *models.NotificationSetting) *models.Notification {
+	n.Store.MarkNotificationReplayed(ntf.ID, time.Now().UTC())
+
+	id := store.NextID("ntf")
+	payload, err := withNotificationID(ntf.Payload, id)
+	if err != nil {
+		payload = ntf.Payload
+	}
+	replay := &models.Notification{
+		ID:                    id,
+		Type:                  ntf.Type,
+		Status:                "not_attempted",
+		Payload:               payload,
+		OccurredAt:            ntf.OccurredAt,
+		Origin:                "replay",
+		NotificationSettingID: ns.ID,
+	}
+	n.notify(ns, replay)
+	return replay
+}
+
+// notify records ntf and queues it for the destination of ns.
+func (n *Notifier) notify(ns *models.NotificationSetting, ntf *models.Notification) {
+	n.Store.SetNotification(ntf)
+	n.pending.Add(1)
+	n.enqueue(ns.Destination, ntf.ID)
+}
+
+// attempt sends ntf to url, logging the response and updating its status and
+// attempt count. Any 2xx response counts as delivered.
+func (n *Notifier) attempt(ntf *models.Notification, url string) {
+	now := time.Now().UTC()
+	entry := &models.NotificationLog{
+		ID:             store.NextID("ntflog"),
+		AttemptedAt:    now,
+		NotificationID: ntf.ID,
+	}
+	resp, err := n.Send(url, ntf.Payload)
+	if resp != nil {
+		entry.ResponseCode = resp.StatusCode
+		entry.ResponseBody = resp.Body
+		if resp.ContentType != "" {
+			entry.ResponseContentType = &resp.ContentType
+		}
+	}
+	if err != nil {
+		// Without a response, the log shows why the request failed.
+		log.Printf("webhook: failed to POST to %s: %v", url, err)
+		entry.ResponseBody = err.Error()
+	} else {
+		log.Printf("webhook: POST %s → %d", url, resp.StatusCode)
+	}
+	n.Store.AddNotificationLog(entry)
+
+	ntf.TimesAttempted++
+	ntf.LastAttemptAt = &now
+	ntf.RetryAt = nil
+	ntf.Status = "failed"
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		ntf.Status = "delivered"
+		ntf.DeliveredAt = &now
 	}
 }
 
-func (n *Notifier) send(url string, payload []byte) {
+// maxResponseBody caps how much of a destination's response body is kept.
+const maxResponseBody = 64 << 10
+
+// Response is a destination's response to a webhook.
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        string
+}
+
+// Send signs payload and POSTs it to url, returning the destination's
+// response. The error is set if the request could not be made, timed out or
+// the body could not be read.
+func (n *Notifier) Send(url string, payload []byte) (*Response, error) {
 	ts := fmt.Sprintf("%d", time.Now().Unix())
 	signedPayload := ts + ":" + string(payload)
 
@@ -67,17 +173,20 @@ func (n *Notifier) send(url string, payload []byte) {
 
 	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
 	if err != nil {
-		log.Printf("webhook: failed to create request for %s: %v", url, err)
-		return
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Paddle-Signature", signature)
 
 	resp, err := n.Client.Do(req)
 	if err != nil {
-		log.Printf("webhook: failed to POST to %s: %v", url, err)
-		return
+		return nil, err
 	}
-	resp.Body.Close()
-	log.Printf("webhook: POST %s → %d (%s)", url, resp.StatusCode, signature[:30]+"...")
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return &Response{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}, err
 }